@@ -0,0 +1,105 @@
+// Command vibectl talks to the Vibeway admin API.
+//
+//	vibectl purge -path '/api/v1/users/*'
+//	vibectl purge -tag user-123 -tag team-7
+//	vibectl purge -key 'vibeway:cache:GET:/google/#0123456789abcdef'
+//
+// The admin token is read from ADMIN_TOKEN, the gateway address from
+// VIBEWAY_ADDR (default http://localhost:8080) or the -addr flag.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "purge":
+		purge(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: vibectl purge [-addr URL] [-key KEY] [-path GLOB] [-tag TAG ...]")
+	os.Exit(2)
+}
+
+func purge(args []string) {
+	fs := flag.NewFlagSet("purge", flag.ExitOnError)
+	addr := fs.String("addr", envOr("VIBEWAY_ADDR", "http://localhost:8080"), "gateway base URL")
+	key := fs.String("key", "", "exact cache key")
+	path := fs.String("path", "", "request path glob, e.g. /api/v1/users/*")
+	var tags stringList
+	fs.Var(&tags, "tag", "surrogate key (repeatable)")
+	_ = fs.Parse(args)
+
+	if *key == "" && *path == "" && len(tags) == 0 {
+		fmt.Fprintln(os.Stderr, "purge needs -key, -path or -tag")
+		os.Exit(2)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"key":  *key,
+		"path": *path,
+		"tags": tags,
+	})
+
+	out, err := call(*addr, http.MethodPost, "/admin/cache/purge", body)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(out)
+}
+
+func call(addr, method, path string, body []byte) (string, error) {
+	req, err := http.NewRequest(method, strings.TrimSuffix(addr, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("ADMIN_TOKEN"))
+
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	return string(bytes.TrimSpace(data)), nil
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
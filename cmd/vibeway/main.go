@@ -8,7 +8,9 @@ import (
 	"strconv"
 	"syscall"
 
+	"vibeway/internal/admin"
 	"vibeway/internal/config"
+	"vibeway/internal/middleware"
 	"vibeway/internal/router"
 	"vibeway/internal/tracing"
 	"vibeway/internal/upstream"
@@ -71,11 +73,17 @@ func main() {
 
 	// 6. Init Fiber
 	app := fiber.New(fiber.Config{
-		AppName: "Vibeway",
+		AppName:      "Vibeway",
+		ErrorHandler: middleware.ErrorHandler,
 	})
 
+	// Tracing first so the request ID can be attached to the server span
+	app.Use(tracing.Middleware())
+	app.Use(middleware.RequestID(config.AppConfig.Server.RequestID))
+
 	// 7. Setup Routes
-	router.SetupRoutes(app, config.AppConfig, upstreams)
+	adminAPI := admin.New(app, config.AppConfig.Admin)
+	router.SetupRoutes(app, config.AppConfig, upstreams, adminAPI)
 
 	// 8. Metrics Endpoint
 	// 8. Metrics Endpoint
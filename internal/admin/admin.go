@@ -0,0 +1,34 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"vibeway/internal/config"
+	"vibeway/internal/middleware"
+	"vibeway/pkg/logger"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// New mounts the admin API group under /admin. Every admin endpoint requires
+// "Authorization: Bearer <admin.token>"; without a configured token the API
+// rejects all calls.
+func New(app *fiber.App, cfg config.AdminConfig) fiber.Router {
+	if cfg.Token == "" {
+		logger.Warn("Admin token not set, admin API disabled", nil)
+	}
+
+	return app.Group("/admin", func(c fiber.Ctx) error {
+		if cfg.Token == "" {
+			return middleware.ErrorJSON(c, fiber.StatusServiceUnavailable, "Admin API disabled")
+		}
+
+		token, ok := strings.CutPrefix(c.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) != 1 {
+			return middleware.ErrorJSON(c, fiber.StatusUnauthorized, "Invalid admin token")
+		}
+
+		return c.Next()
+	})
+}
@@ -0,0 +1,216 @@
+package concurrency
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"vibeway/internal/config"
+	"vibeway/internal/metrics"
+)
+
+// Algorithms an adaptive limiter adjusts its limit with.
+const (
+	AlgorithmGradient = "gradient"
+	AlgorithmAIMD     = "aimd"
+)
+
+const (
+	defaultInitialLimit = 20
+	defaultMinLimit     = 1
+	defaultMaxLimit     = 1000
+	defaultTolerance    = 1.5
+	defaultSmoothing    = 0.2
+	defaultBackoffRatio = 0.9
+
+	// Samples are averaged over windows of at least this long and this many
+	windowDuration   = 100 * time.Millisecond
+	minWindowSamples = 10
+
+	// Windows the baseline latency rises over
+	baselineWindows = 600
+)
+
+// AdaptiveLimiter sheds requests to an upstream beyond a limit that follows
+// the upstream's latency. Samples are averaged over short windows and
+// compared to a baseline close to the lowest window average seen; as
+// latency rises above the baseline, the limit shrinks.
+//
+// gradient (after Netflix's Gradient2) scales the limit by baseline/recent,
+// within [0.5, 1], and adds sqrt(limit) of headroom; aimd adds one while the
+// limit is in use and multiplies by the backoff ratio when a request is
+// dropped or slower than the baseline by more than the tolerance.
+type AdaptiveLimiter struct {
+	name      string
+	algorithm string
+	minLimit  float64
+	maxLimit  float64
+	tolerance float64
+	smoothing float64
+	backoff   float64
+
+	now func() time.Time
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+	baseline float64 // Latency in nanoseconds, 0 before the first window
+	window   sampleWindow
+}
+
+type sampleWindow struct {
+	start       time.Time
+	samples     int
+	rttSum      float64
+	dropped     bool
+	maxInflight int
+}
+
+// NewAdaptiveLimiter returns nil if cfg is not enabled.
+func NewAdaptiveLimiter(name string, cfg config.AdaptiveConcurrencyConfig) (*AdaptiveLimiter, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	a := &AdaptiveLimiter{
+		name:      name,
+		algorithm: cfg.Algorithm,
+		minLimit:  float64(cfg.MinLimit),
+		maxLimit:  float64(cfg.MaxLimit),
+		tolerance: cfg.Tolerance,
+		smoothing: cfg.Smoothing,
+		backoff:   cfg.BackoffRatio,
+		limit:     float64(cfg.InitialLimit),
+		now:       time.Now,
+	}
+	if a.algorithm == "" {
+		a.algorithm = AlgorithmGradient
+	}
+	if a.algorithm != AlgorithmGradient && a.algorithm != AlgorithmAIMD {
+		return nil, fmt.Errorf("adaptive concurrency algorithm must be gradient or aimd, got %q", cfg.Algorithm)
+	}
+	if a.minLimit <= 0 {
+		a.minLimit = defaultMinLimit
+	}
+	if a.maxLimit <= 0 {
+		a.maxLimit = defaultMaxLimit
+	}
+	if a.minLimit > a.maxLimit {
+		return nil, fmt.Errorf("adaptive concurrency min_limit %d exceeds max_limit %d", cfg.MinLimit, cfg.MaxLimit)
+	}
+	if a.limit <= 0 {
+		a.limit = defaultInitialLimit
+	}
+	a.limit = math.Min(math.Max(a.limit, a.minLimit), a.maxLimit)
+	if a.tolerance < 1 {
+		a.tolerance = defaultTolerance
+	}
+	if a.smoothing <= 0 || a.smoothing > 1 {
+		a.smoothing = defaultSmoothing
+	}
+	if a.backoff <= 0 || a.backoff >= 1 {
+		a.backoff = defaultBackoffRatio
+	}
+
+	metrics.AdaptiveConcurrencyLimit.WithLabelValues(name).Set(a.limit)
+	return a, nil
+}
+
+// Limit returns the current limit.
+func (a *AdaptiveLimiter) Limit() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return int(a.limit)
+}
+
+// Acquire admits a request unless the share of the limit it may use, 1 for
+// all of it, is reached. Every class keeps at least one slot.
+func (a *AdaptiveLimiter) Acquire(share float64) (*Inflight, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.inflight >= max(1, int(a.limit*share)) {
+		metrics.AdaptiveConcurrencyShedTotal.WithLabelValues(a.name).Inc()
+		return nil, false
+	}
+	a.inflight++
+	return &Inflight{limiter: a}, true
+}
+
+// Inflight is an admitted upstream call. Calls that fail before reaching the
+// upstream are released without an observation.
+type Inflight struct {
+	limiter  *AdaptiveLimiter
+	released atomic.Bool
+}
+
+// Observe feeds the latency of an upstream call into the limit. Dropped
+// calls failed or were turned away by an overloaded upstream.
+func (f *Inflight) Observe(rtt time.Duration, dropped bool) {
+	if f == nil {
+		return
+	}
+	f.limiter.observe(float64(rtt), dropped)
+}
+
+func (f *Inflight) Release() {
+	if f == nil || !f.released.CompareAndSwap(false, true) {
+		return
+	}
+	f.limiter.mu.Lock()
+	f.limiter.inflight--
+	f.limiter.mu.Unlock()
+}
+
+func (a *AdaptiveLimiter) observe(rtt float64, dropped bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	w := &a.window
+	if w.samples == 0 {
+		w.start = a.now()
+	}
+	w.samples++
+	w.rttSum += rtt
+	w.dropped = w.dropped || dropped
+	w.maxInflight = max(w.maxInflight, a.inflight)
+	if w.samples < minWindowSamples || a.now().Sub(w.start) < windowDuration {
+		return
+	}
+	a.update(w.rttSum/float64(w.samples), w.dropped, w.maxInflight)
+	*w = sampleWindow{}
+}
+
+// update adjusts the limit once per window of samples.
+func (a *AdaptiveLimiter) update(rtt float64, dropped bool, maxInflight int) {
+	// The baseline follows drops in latency at once and rises only slowly, so
+	// sustained congestion does not become the new normal
+	if a.baseline == 0 || rtt < a.baseline {
+		a.baseline = rtt
+	} else {
+		a.baseline += (rtt - a.baseline) / baselineWindows
+	}
+
+	limit := a.limit
+	// Below half the limit the latency says nothing about the limit
+	inUse := 2*maxInflight >= int(limit)
+	switch a.algorithm {
+	case AlgorithmAIMD:
+		if dropped || rtt > a.tolerance*a.baseline {
+			limit *= a.backoff
+		} else if inUse {
+			limit++
+		}
+	default:
+		if !inUse {
+			return
+		}
+		gradient := math.Min(math.Max(a.tolerance*a.baseline/rtt, 0.5), 1)
+		target := limit*gradient + math.Sqrt(limit)
+		limit = limit*(1-a.smoothing) + target*a.smoothing
+	}
+
+	a.limit = math.Min(math.Max(limit, a.minLimit), a.maxLimit)
+	metrics.AdaptiveConcurrencyLimit.WithLabelValues(a.name).Set(a.limit)
+}
@@ -0,0 +1,162 @@
+package concurrency
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"vibeway/internal/config"
+)
+
+func TestAdaptiveLimiterUpdate(t *testing.T) {
+	type window struct {
+		rtt         time.Duration
+		dropped     bool
+		maxInflight int
+	}
+
+	tests := []struct {
+		name    string
+		cfg     config.AdaptiveConcurrencyConfig
+		windows []window
+		want    float64
+	}{
+		{
+			name:    "gradient grows at steady latency",
+			cfg:     config.AdaptiveConcurrencyConfig{Algorithm: AlgorithmGradient, InitialLimit: 20},
+			windows: []window{{rtt: 10 * time.Millisecond, maxInflight: 20}},
+			// 20*0.8 + (20 + sqrt(20))*0.2
+			want: 20.8944,
+		},
+		{
+			name:    "gradient holds while the limit is mostly unused",
+			cfg:     config.AdaptiveConcurrencyConfig{Algorithm: AlgorithmGradient, InitialLimit: 20},
+			windows: []window{{rtt: 10 * time.Millisecond, maxInflight: 9}},
+			want:    20,
+		},
+		{
+			name: "gradient shrinks when latency rises",
+			cfg:  config.AdaptiveConcurrencyConfig{Algorithm: AlgorithmGradient, InitialLimit: 20},
+			windows: []window{
+				{rtt: 10 * time.Millisecond, maxInflight: 20},
+				{rtt: 40 * time.Millisecond, maxInflight: 20},
+			},
+			// The gradient bottoms out at 0.5: 20.8944*0.8 + (20.8944*0.5 + sqrt(20.8944))*0.2
+			want: 19.7192,
+		},
+		{
+			name:    "aimd adds one while in use",
+			cfg:     config.AdaptiveConcurrencyConfig{Algorithm: AlgorithmAIMD, InitialLimit: 20},
+			windows: []window{{rtt: 10 * time.Millisecond, maxInflight: 10}},
+			want:    21,
+		},
+		{
+			name:    "aimd holds while the limit is mostly unused",
+			cfg:     config.AdaptiveConcurrencyConfig{Algorithm: AlgorithmAIMD, InitialLimit: 20},
+			windows: []window{{rtt: 10 * time.Millisecond, maxInflight: 9}},
+			want:    20,
+		},
+		{
+			name:    "aimd backs off on drops",
+			cfg:     config.AdaptiveConcurrencyConfig{Algorithm: AlgorithmAIMD, InitialLimit: 20},
+			windows: []window{{rtt: 10 * time.Millisecond, dropped: true, maxInflight: 20}},
+			want:    18,
+		},
+		{
+			name: "aimd backs off beyond the tolerance",
+			cfg:  config.AdaptiveConcurrencyConfig{Algorithm: AlgorithmAIMD, InitialLimit: 20, Tolerance: 1.5},
+			windows: []window{
+				{rtt: 10 * time.Millisecond, maxInflight: 20},
+				{rtt: 14 * time.Millisecond, maxInflight: 21},
+				{rtt: 20 * time.Millisecond, maxInflight: 22},
+			},
+			want: 22 * 0.9,
+		},
+		{
+			name: "min limit",
+			cfg:  config.AdaptiveConcurrencyConfig{Algorithm: AlgorithmAIMD, InitialLimit: 5, MinLimit: 5},
+			windows: []window{
+				{rtt: 10 * time.Millisecond, dropped: true, maxInflight: 5},
+				{rtt: 10 * time.Millisecond, dropped: true, maxInflight: 5},
+			},
+			want: 5,
+		},
+		{
+			name:    "max limit",
+			cfg:     config.AdaptiveConcurrencyConfig{Algorithm: AlgorithmGradient, InitialLimit: 50, MaxLimit: 50},
+			windows: []window{{rtt: 10 * time.Millisecond, maxInflight: 50}},
+			want:    50,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Enabled = true
+			a, err := NewAdaptiveLimiter("test", tt.cfg)
+			if err != nil {
+				t.Fatalf("NewAdaptiveLimiter: %v", err)
+			}
+			for _, w := range tt.windows {
+				a.update(float64(w.rtt), w.dropped, w.maxInflight)
+			}
+			if math.Abs(a.limit-tt.want) > 0.001 {
+				t.Errorf("limit = %.4f, want %.4f", a.limit, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdaptiveLimiterBaseline(t *testing.T) {
+	a, err := NewAdaptiveLimiter("test", config.AdaptiveConcurrencyConfig{Enabled: true})
+	if err != nil {
+		t.Fatalf("NewAdaptiveLimiter: %v", err)
+	}
+
+	a.update(float64(20*time.Millisecond), false, 0)
+	a.update(float64(10*time.Millisecond), false, 0)
+	if a.baseline != float64(10*time.Millisecond) {
+		t.Errorf("baseline = %v after a faster window, want it to drop to 10ms", time.Duration(a.baseline))
+	}
+
+	a.update(float64(70*time.Millisecond), false, 0)
+	if want := float64(10*time.Millisecond) + float64(60*time.Millisecond)/baselineWindows; math.Abs(a.baseline-want) > 1 {
+		t.Errorf("baseline = %v after a slower window, want %v", time.Duration(a.baseline), time.Duration(want))
+	}
+}
+
+func TestAdaptiveLimiterAcquireShare(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		share float64
+		want  int
+	}{
+		{"whole limit", 10, 1, 10},
+		{"share truncates", 10, 0.55, 5},
+		{"every class keeps a slot", 1, 0.5, 1},
+		{"tiny share", 4, 0.1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewAdaptiveLimiter("test", config.AdaptiveConcurrencyConfig{
+				Enabled:      true,
+				InitialLimit: tt.limit,
+				MinLimit:     1,
+			})
+			if err != nil {
+				t.Fatalf("NewAdaptiveLimiter: %v", err)
+			}
+
+			admitted := 0
+			for range tt.limit + 1 {
+				if _, ok := a.Acquire(tt.share); ok {
+					admitted++
+				}
+			}
+			if admitted != tt.want {
+				t.Errorf("admitted %d, want %d", admitted, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package concurrency
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"vibeway/internal/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Backends a limiter keeps its slots in.
+const (
+	BackendLocal = "local"
+	BackendRedis = "redis"
+)
+
+// Keys a route limiter keeps separate slots per.
+const (
+	KeyRoute    = "route"
+	KeyConsumer = "consumer"
+)
+
+const (
+	defaultQueueTimeout = time.Second
+	defaultLease        = 30 * time.Second
+
+	// Slots freed on other instances are not announced, so queued requests
+	// on the redis backend poll for them.
+	redisPollInterval = 25 * time.Millisecond
+)
+
+var (
+	ErrQueueFull    = errors.New("concurrency queue full")
+	ErrQueueTimeout = errors.New("timed out waiting for a concurrency slot")
+)
+
+// slots counts in-flight requests per key.
+type slots interface {
+	tryAcquire(ctx context.Context, key string) (release func(), ok bool, err error)
+}
+
+// Limiter caps in-flight requests per key. Requests over the cap wait for a
+// slot in a bounded FIFO queue per key, which is local to the instance even
+// when the slots are shared through Redis.
+type Limiter struct {
+	name         string
+	key          string
+	queueSize    int
+	queueTimeout time.Duration
+	rejectStatus int
+	pollInterval time.Duration
+
+	slots slots
+
+	mu     sync.Mutex
+	queues map[string]*list.List // Of chan struct{}, by key
+}
+
+// NewLimiter returns nil if cfg sets no limit.
+func NewLimiter(name string, cfg config.ConcurrencyConfig, client *redis.Client) (*Limiter, error) {
+	if cfg.Limit <= 0 {
+		return nil, nil
+	}
+
+	l := &Limiter{
+		name:         name,
+		key:          cfg.Key,
+		queueSize:    cfg.QueueSize,
+		queueTimeout: time.Duration(cfg.QueueTimeoutMs) * time.Millisecond,
+		rejectStatus: cfg.RejectStatus,
+		queues:       make(map[string]*list.List),
+	}
+	if l.key == "" {
+		l.key = KeyRoute
+	}
+	if l.key != KeyRoute && l.key != KeyConsumer {
+		return nil, fmt.Errorf("concurrency key must be route or consumer, got %q", cfg.Key)
+	}
+	if l.queueSize < 0 {
+		return nil, fmt.Errorf("concurrency queue size must not be negative, got %d", cfg.QueueSize)
+	}
+	if l.queueTimeout <= 0 {
+		l.queueTimeout = defaultQueueTimeout
+	}
+	switch l.rejectStatus {
+	case 0:
+		l.rejectStatus = http.StatusServiceUnavailable
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+	default:
+		return nil, fmt.Errorf("concurrency reject status must be 429 or 503, got %d", cfg.RejectStatus)
+	}
+
+	switch cfg.Backend {
+	case "", BackendLocal:
+		l.slots = newLocalSlots(cfg.Limit)
+	case BackendRedis:
+		if client == nil {
+			return nil, errors.New("concurrency redis backend needs redis")
+		}
+		lease := time.Duration(cfg.LeaseSeconds) * time.Second
+		if lease <= 0 {
+			lease = defaultLease
+		}
+		l.slots = newRedisSlots(client, name, cfg.Limit, lease)
+		l.pollInterval = redisPollInterval
+	default:
+		return nil, fmt.Errorf("concurrency backend must be local or redis, got %q", cfg.Backend)
+	}
+	return l, nil
+}
+
+func (l *Limiter) Name() string {
+	return l.name
+}
+
+// Key returns what slots are kept per: KeyRoute or KeyConsumer.
+func (l *Limiter) Key() string {
+	return l.key
+}
+
+func (l *Limiter) RejectStatus() int {
+	return l.rejectStatus
+}
+
+// Acquire takes a slot under key, waiting in the queue if none is free, and
+// returns the function that gives it back. It fails with ErrQueueFull or
+// ErrQueueTimeout, or the backend's error.
+func (l *Limiter) Acquire(ctx context.Context, key string) (func(), error) {
+	if l.queueLen(key) == 0 {
+		release, ok, err := l.try(ctx, key)
+		if err != nil || ok {
+			return release, err
+		}
+	}
+
+	l.mu.Lock()
+	q := l.queues[key]
+	if q == nil {
+		q = list.New()
+		l.queues[key] = q
+	}
+	if q.Len() >= l.queueSize {
+		l.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+	wake := make(chan struct{}, 1)
+	elem := q.PushBack(wake)
+	l.mu.Unlock()
+	defer l.dequeue(key, elem)
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	var poll <-chan time.Time
+	if l.pollInterval > 0 {
+		ticker := time.NewTicker(l.pollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		if l.atHead(key, elem) {
+			release, ok, err := l.try(ctx, key)
+			if err != nil || ok {
+				return release, err
+			}
+		}
+		select {
+		case <-wake:
+		case <-poll:
+		case <-timer.C:
+			return nil, ErrQueueTimeout
+		case <-ctx.Done():
+			return nil, ErrQueueTimeout
+		}
+	}
+}
+
+// try takes a slot if one is free; giving it back wakes the next in line.
+func (l *Limiter) try(ctx context.Context, key string) (func(), bool, error) {
+	release, ok, err := l.slots.tryAcquire(ctx, key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			release()
+			l.wakeHead(key)
+		})
+	}, true, nil
+}
+
+func (l *Limiter) queueLen(key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if q := l.queues[key]; q != nil {
+		return q.Len()
+	}
+	return 0
+}
+
+func (l *Limiter) atHead(key string, elem *list.Element) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.queues[key].Front() == elem
+}
+
+func (l *Limiter) wakeHead(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if q := l.queues[key]; q != nil && q.Len() > 0 {
+		select {
+		case q.Front().Value.(chan struct{}) <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// dequeue leaves the queue. The next in line may have missed a wake-up meant
+// for the leaving request, so it is woken to try for itself.
+func (l *Limiter) dequeue(key string, elem *list.Element) {
+	l.mu.Lock()
+	q := l.queues[key]
+	wasHead := q.Front() == elem
+	q.Remove(elem)
+	if q.Len() == 0 {
+		delete(l.queues, key)
+	}
+	l.mu.Unlock()
+
+	if wasHead {
+		l.wakeHead(key)
+	}
+}
@@ -0,0 +1,35 @@
+package concurrency
+
+import (
+	"context"
+	"sync"
+)
+
+// localSlots counts in-flight requests of this instance only.
+type localSlots struct {
+	limit int
+
+	mu    sync.Mutex
+	inUse map[string]int
+}
+
+func newLocalSlots(limit int) *localSlots {
+	return &localSlots{limit: limit, inUse: make(map[string]int)}
+}
+
+func (s *localSlots) tryAcquire(_ context.Context, key string) (func(), bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inUse[key] >= s.limit {
+		return nil, false, nil
+	}
+	s.inUse[key]++
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.inUse[key]--; s.inUse[key] <= 0 {
+			delete(s.inUse, key)
+		}
+	}, true, nil
+}
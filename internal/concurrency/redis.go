@@ -0,0 +1,105 @@
+package concurrency
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"vibeway/pkg/logger"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const releaseTimeout = time.Second
+
+// acquireScript takes a slot in a sorted set of lease tokens scored by
+// expiry, after dropping expired leases. Redis time keeps instance clocks
+// out of it. KEYS[1] is the set, ARGV limit, lease ms and token.
+var acquireScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = t[1] * 1000 + math.floor(t[2] / 1000)
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], now + tonumber(ARGV[2]), ARGV[3])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+// renewScript extends a lease that has not expired yet. ARGV lease ms and
+// token.
+var renewScript = redis.NewScript(`
+if not redis.call('ZSCORE', KEYS[1], ARGV[2]) then
+	return 0
+end
+local t = redis.call('TIME')
+local now = t[1] * 1000 + math.floor(t[2] / 1000)
+redis.call('ZADD', KEYS[1], now + tonumber(ARGV[1]), ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[1])
+return 1
+`)
+
+// redisSlots shares slots across instances. Slots are leases renewed while
+// held, so the slots of a crashed instance free up once their lease expires.
+type redisSlots struct {
+	client *redis.Client
+	name   string
+	limit  int
+	lease  time.Duration
+}
+
+func newRedisSlots(client *redis.Client, name string, limit int, lease time.Duration) *redisSlots {
+	return &redisSlots{client: client, name: name, limit: limit, lease: lease}
+}
+
+func (s *redisSlots) tryAcquire(ctx context.Context, key string) (func(), bool, error) {
+	setKey := "concurrency:" + s.name + ":" + key
+	token := newToken()
+
+	ok, err := acquireScript.Run(ctx, s.client, []string{setKey}, s.limit, s.lease.Milliseconds(), token).Bool()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	done := make(chan struct{})
+	go s.renew(setKey, token, done)
+
+	return func() {
+		close(done)
+		ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+		defer cancel()
+		if err := s.client.ZRem(ctx, setKey, token).Err(); err != nil {
+			// The lease runs out on its own
+			logger.Warn("Failed to release concurrency slot", map[string]interface{}{"limiter": s.name, "error": err.Error()})
+		}
+	}, true, nil
+}
+
+func (s *redisSlots) renew(setKey, token string, done <-chan struct{}) {
+	ticker := time.NewTicker(s.lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+			ok, err := renewScript.Run(ctx, s.client, []string{setKey}, s.lease.Milliseconds(), token).Bool()
+			cancel()
+			if err != nil || !ok {
+				logger.Warn("Failed to renew concurrency slot lease", map[string]interface{}{
+					"limiter": s.name,
+					"expired": err == nil,
+				})
+			}
+		}
+	}
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -14,20 +14,338 @@ type Config struct {
 	Routes    []RouteConfig             `mapstructure:"routes"`
 	Upstreams map[string]UpstreamConfig `mapstructure:"upstreams"`
 	Security  SecurityConfig            `mapstructure:"security"`
+	Admin     AdminConfig               `mapstructure:"admin"`
+
+	ResponseCache ResponseCacheConfig `mapstructure:"response_cache"`
+	Maintenance   MaintenanceConfig   `mapstructure:"maintenance"` // Global switch and defaults
+	Quotas        []QuotaConfig       `mapstructure:"quotas"`
+	LoadShedding  LoadSheddingConfig  `mapstructure:"load_shedding"`
+}
+
+// LoadSheddingConfig sheds lower criticality classes (critical, normal, low)
+// first under overload, with 503 and Retry-After. Reserved keeps a share of
+// capacity for a class and the classes above it: {critical: 0.2, normal: 0.3}
+// lets low traffic use 50% and normal 80% of MaxInflight, or of an
+// upstream's adaptive concurrency limit.
+type LoadSheddingConfig struct {
+	MaxInflight       int                `mapstructure:"max_inflight"` // Gateway-wide; 0 sheds only at adaptive upstream limits
+	Reserved          map[string]float64 `mapstructure:"reserved"`
+	Claim             string             `mapstructure:"claim"`               // JWT claim setting a consumer's class
+	Header            string             `mapstructure:"header"`              // Lets clients lower, never raise, their class
+	RetryAfterSeconds int                `mapstructure:"retry_after_seconds"` // Default 1
+}
+
+// QuotaConfig is an allowance of Limit requests per calendar day or month
+// for each consumer, counted gateway-wide in Redis. Identity is sub,
+// client_id (claim), api_key (X-API-Key) or consumer (sub, else api_key,
+// the default); requests without one are not counted. API keys are
+// identified as hex(sha256(key)[:8]), the first 16 hex digits of the hash.
+type QuotaConfig struct {
+	Name     string `mapstructure:"name"`
+	Limit    int64  `mapstructure:"limit"`
+	Period   string `mapstructure:"period"`   // day or month
+	Timezone string `mapstructure:"timezone"` // IANA name the period starts in, default UTC
+	Identity string `mapstructure:"identity"`
+}
+
+// MaintenanceConfig answers requests with 503 and Retry-After while enabled.
+// Route and upstream blocks inherit unset fields from the global block.
+type MaintenanceConfig struct {
+	Enabled           bool                    `mapstructure:"enabled"`
+	RetryAfterSeconds int                     `mapstructure:"retry_after_seconds"`
+	Message           string                  `mapstructure:"message"`      // For the default JSON error body
+	Body              string                  `mapstructure:"body"`         // Custom JSON or HTML body
+	ContentType       string                  `mapstructure:"content_type"` // Of Body, default application/json
+	Bypass            MaintenanceBypassConfig `mapstructure:"bypass"`
+}
+
+// MaintenanceBypassConfig lets matching requests through during maintenance.
+type MaintenanceBypassConfig struct {
+	CIDRs       []string `mapstructure:"cidrs"`
+	Header      string   `mapstructure:"header"`       // Defaults to X-Maintenance-Bypass
+	HeaderValue string   `mapstructure:"header_value"` // Shared secret
+	Roles       []string `mapstructure:"roles"`        // JWT roles claim
+}
+
+// ResponseCacheConfig sizes the in-memory LRU tier that sits in front of the
+// shared Redis response cache.
+type ResponseCacheConfig struct {
+	MemoryMaxEntries int `mapstructure:"memory_max_entries"` // Default 10000
+	MemoryMaxBytes   int `mapstructure:"memory_max_bytes"`   // Default 64 MiB
+}
+
+// AdminConfig protects the runtime admin API. Set the token through the
+// ADMIN_TOKEN environment variable in production.
+type AdminConfig struct {
+	Token string `mapstructure:"token"`
 }
 
 type ServerConfig struct {
-	Port             int    `mapstructure:"port"`
-	Mode             string `mapstructure:"mode"`
-	RequestTimeoutMs int    `mapstructure:"request_timeout_ms"`
+	Port             int             `mapstructure:"port"`
+	Mode             string          `mapstructure:"mode"`
+	RequestTimeoutMs int             `mapstructure:"request_timeout_ms"`
+	RequestID        RequestIDConfig `mapstructure:"request_id"`
+}
+
+// RequestIDConfig controls request correlation IDs. Incoming IDs in Header
+// that match Pattern are kept; otherwise a new one is generated.
+type RequestIDConfig struct {
+	Header    string `mapstructure:"header"`    // Defaults to X-Request-Id
+	Generator string `mapstructure:"generator"` // uuidv7 (default) or ulid
+	Pattern   string `mapstructure:"pattern"`   // Regex for accepted incoming IDs
 }
 
 type RouteConfig struct {
+	Name         string   `mapstructure:"name"` // Defaults to Path
+	Type         string   `mapstructure:"type"` // proxy (default), static, redirect, mock or compose
 	Path         string   `mapstructure:"path"`
 	Methods      []string `mapstructure:"methods"`
 	Upstream     string   `mapstructure:"upstream"`
 	Middlewares  []string `mapstructure:"middlewares"`
 	AllowedRoles []string `mapstructure:"allowed_roles"`
+	Criticality  string   `mapstructure:"criticality"` // critical, normal (default) or low
+
+	// Limits of the "ratelimit" middleware, all checked in one Redis round
+	// trip. Without any, security.rate_limit.per_route applies per route and IP.
+	RateLimits []LimitConfig `mapstructure:"rate_limits"`
+	Cost       CostConfig    `mapstructure:"cost"`
+
+	ResponseRewrite ResponseRewriteConfig `mapstructure:"response_rewrite"`
+	RequestHeaders  HeaderTransformConfig `mapstructure:"request_headers"`
+	ResponseHeaders HeaderTransformConfig `mapstructure:"response_headers"`
+	RequestBody     BodyTransformConfig   `mapstructure:"request_body"`
+	ResponseBody    BodyTransformConfig   `mapstructure:"response_body"`
+	Mirror          MirrorConfig          `mapstructure:"mirror"`
+	Split           SplitConfig           `mapstructure:"split"`
+	Rules           []MatchRuleConfig     `mapstructure:"rules"`
+	Fault           FaultConfig           `mapstructure:"fault"`
+	Cache           CacheConfig           `mapstructure:"cache"`
+	Coalesce        CoalesceConfig        `mapstructure:"coalesce"`
+
+	Maintenance MaintenanceConfig `mapstructure:"maintenance"`
+	Concurrency ConcurrencyConfig `mapstructure:"concurrency"`
+
+	Compression          CompressionConfig          `mapstructure:"compression"`
+	RequestDecompression RequestDecompressionConfig `mapstructure:"request_decompression"`
+
+	Static   StaticResponseConfig `mapstructure:"static"`
+	Redirect RedirectConfig       `mapstructure:"redirect"`
+	Mock     MockConfig           `mapstructure:"mock"`
+	Compose  ComposeConfig        `mapstructure:"compose"`
+}
+
+// RouteName returns the configured route name, falling back to its path.
+func (r RouteConfig) RouteName() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.Path
+}
+
+// ResponseRewriteConfig controls how upstream responses are rewritten so that
+// clients never see internal upstream hosts.
+type ResponseRewriteConfig struct {
+	Location         bool     `mapstructure:"location"`           // Rewrite Location and Content-Location
+	Cookies          bool     `mapstructure:"cookies"`            // Rewrite Set-Cookie domain and path
+	CookieDomain     string   `mapstructure:"cookie_domain"`      // Empty drops the Domain attribute
+	Body             bool     `mapstructure:"body"`               // Replace absolute upstream URLs in bodies
+	BodyContentTypes []string `mapstructure:"body_content_types"` // Defaults to HTML and JSON
+}
+
+// HeaderTransformConfig declares header operations, applied in the order
+// remove, rename, set, add. Set and add values may contain templates such as
+// ${claims.tenant}, ${client_ip}, ${request_id}, ${route}, ${upstream_url}
+// and ${env.NAME}. Remove entries ending in "*" match by prefix.
+type HeaderTransformConfig struct {
+	Add    map[string]string `mapstructure:"add"`
+	Set    map[string]string `mapstructure:"set"`
+	Remove []string          `mapstructure:"remove"`
+	Rename map[string]string `mapstructure:"rename"`
+}
+
+// BodyTransformConfig declares JSON body operations. Bodies larger than
+// MaxBytes (default 1 MiB), compressed bodies and non-JSON content types are
+// passed through untouched.
+type BodyTransformConfig struct {
+	MaxBytes   int                   `mapstructure:"max_bytes"`
+	Operations []BodyOperationConfig `mapstructure:"operations"`
+}
+
+// BodyOperationConfig is a single operation: remove, rename, set or move.
+// Path is a JSONPath-style selector such as "$.items[*].internal_notes".
+// For rename, To is the new key name; for move, To is the target selector.
+type BodyOperationConfig struct {
+	Op    string      `mapstructure:"op"`
+	Path  string      `mapstructure:"path"`
+	To    string      `mapstructure:"to"`
+	Value interface{} `mapstructure:"value"`
+}
+
+// MirrorConfig sends a sampled, fire-and-forget copy of route traffic to a
+// secondary upstream. Mirror responses are discarded.
+type MirrorConfig struct {
+	Upstream        string   `mapstructure:"upstream"`
+	Percentage      float64  `mapstructure:"percentage"`        // 0-100
+	MaxConcurrent   int      `mapstructure:"max_concurrent"`    // Default 100; excess copies are dropped
+	TimeoutMs       int      `mapstructure:"timeout_ms"`        // Default 1000
+	RedactHeaders   []string `mapstructure:"redact_headers"`    // Removed from the copy
+	RedactBodyPaths []string `mapstructure:"redact_body_paths"` // JSON selectors removed from the copy
+	DropBody        bool     `mapstructure:"drop_body"`
+}
+
+// SplitConfig spreads a route's traffic across several upstreams by weight,
+// e.g. for canary releases. When set it takes precedence over Upstream.
+// Weights are relative; they do not need to add up to 100.
+type SplitConfig struct {
+	Variants         []VariantConfig `mapstructure:"variants"`
+	StickyCookie     string          `mapstructure:"sticky_cookie"`      // Keeps a client on its assigned variant
+	StickyTTLSeconds int             `mapstructure:"sticky_ttl_seconds"` // Default 86400
+}
+
+type VariantConfig struct {
+	Upstream string `mapstructure:"upstream"`
+	Weight   int    `mapstructure:"weight"`
+}
+
+// MatchRuleConfig routes requests to Upstream when every condition in When
+// holds. Rules are evaluated in order before any split; requests matching no
+// rule use the route's split or default upstream. Conditions look like
+// `claims.tenant in [acme, globex]`, `claims.beta == true`,
+// `header.X-Employee exists` or `cookie.beta matches ^(1|true)$`.
+type MatchRuleConfig struct {
+	Upstream string   `mapstructure:"upstream"`
+	When     []string `mapstructure:"when"`
+}
+
+// FaultConfig injects delays or aborts for chaos testing. When Header is set
+// only requests carrying it (with HeaderValue, if given) are affected.
+// Enabled is the initial state; it can be toggled through the admin API.
+type FaultConfig struct {
+	Enabled     bool             `mapstructure:"enabled"`
+	Header      string           `mapstructure:"header"`
+	HeaderValue string           `mapstructure:"header_value"`
+	Delay       FaultDelayConfig `mapstructure:"delay"`
+	Abort       FaultAbortConfig `mapstructure:"abort"`
+}
+
+// FaultDelayConfig adds FixedMs, or a random delay between FixedMs and MaxMs.
+type FaultDelayConfig struct {
+	Percentage float64 `mapstructure:"percentage"`
+	FixedMs    int     `mapstructure:"fixed_ms"`
+	MaxMs      int     `mapstructure:"max_ms"`
+}
+
+type FaultAbortConfig struct {
+	Percentage float64 `mapstructure:"percentage"`
+	Status     int     `mapstructure:"status"` // Default 503
+}
+
+// CacheConfig enables HTTP response caching for a route. Freshness follows
+// the upstream's Cache-Control and Expires headers; the defaults here apply
+// only when the upstream sends none.
+type CacheConfig struct {
+	Enabled                     bool           `mapstructure:"enabled"`
+	DefaultTTLSeconds           int            `mapstructure:"default_ttl_seconds"` // 0 = only cache with explicit freshness
+	StaleWhileRevalidateSeconds int            `mapstructure:"stale_while_revalidate_seconds"`
+	StaleIfErrorSeconds         int            `mapstructure:"stale_if_error_seconds"`
+	MaxBodyBytes                int            `mapstructure:"max_body_bytes"` // Default 1 MiB
+	Key                         CacheKeyConfig `mapstructure:"key"`
+}
+
+// CacheKeyConfig selects what, beyond method and path, distinguishes cache
+// entries. QueryParams may be ["*"] for the whole sorted query string.
+type CacheKeyConfig struct {
+	QueryParams []string `mapstructure:"query_params"`
+	Headers     []string `mapstructure:"headers"`
+	JWTSubject  bool     `mapstructure:"jwt_subject"`
+}
+
+// CoalesceConfig collapses concurrent identical GETs (same method, URL,
+// Authorization/JWT subject and Headers) into one upstream call. Waiters
+// fetch on their own after MaxWaitMs or when the response is private.
+type CoalesceConfig struct {
+	Enabled   bool     `mapstructure:"enabled"`
+	MaxWaitMs int      `mapstructure:"max_wait_ms"` // Default 5000
+	Headers   []string `mapstructure:"headers"`
+}
+
+// CompressionConfig compresses responses for clients that accept it.
+// Responses the upstream already encoded are passed through.
+type CompressionConfig struct {
+	Enabled      bool     `mapstructure:"enabled"`
+	Encodings    []string `mapstructure:"encodings"`     // Preference order, default [br, zstd, gzip]
+	MinBytes     int      `mapstructure:"min_bytes"`     // Default 1024
+	ContentTypes []string `mapstructure:"content_types"` // Allowlist, "text/*" matches a whole type; defaults to text, JSON, JS, XML and SVG
+}
+
+// RequestDecompressionConfig decodes gzip, deflate, br and zstd request
+// bodies before they are proxied.
+type RequestDecompressionConfig struct {
+	Enabled  bool `mapstructure:"enabled"`
+	MaxBytes int  `mapstructure:"max_bytes"` // Decoded size cap, default 10 MiB
+}
+
+// ConcurrencyConfig caps in-flight requests at Limit (0 disables). Requests
+// over the cap wait in a FIFO queue of QueueSize for up to QueueTimeoutMs,
+// or are rejected with RejectStatus right away when QueueSize is 0. The
+// redis backend shares the cap across instances; its slots are leases, so a
+// crashed instance's slots free up once their lease expires.
+type ConcurrencyConfig struct {
+	Limit          int    `mapstructure:"limit"`
+	Key            string `mapstructure:"key"` // route (default) or consumer; routes only
+	QueueSize      int    `mapstructure:"queue_size"`
+	QueueTimeoutMs int    `mapstructure:"queue_timeout_ms"` // Default 1000
+	RejectStatus   int    `mapstructure:"reject_status"`    // 429 or 503 (default)
+	Backend        string `mapstructure:"backend"`          // local (default) or redis
+	LeaseSeconds   int    `mapstructure:"lease_seconds"`    // Renewed while held, default 30
+}
+
+// StaticResponseConfig answers a "static" route with Body or the contents of
+// File (read at startup). Header values may use ${...} templates.
+type StaticResponseConfig struct {
+	Status      int               `mapstructure:"status"` // Default 200
+	Body        string            `mapstructure:"body"`
+	File        string            `mapstructure:"file"`
+	ContentType string            `mapstructure:"content_type"` // Defaults from File extension, else text/plain
+	Headers     map[string]string `mapstructure:"headers"`
+}
+
+// RedirectConfig answers a "redirect" route. Location is a template that can
+// use path captures, e.g. "/api/v2/users/${path.id}?${query}".
+type RedirectConfig struct {
+	Status   int               `mapstructure:"status"` // 301, 302 (default), 307 or 308
+	Location string            `mapstructure:"location"`
+	Headers  map[string]string `mapstructure:"headers"`
+}
+
+// MockConfig answers a "mock" route with a canned JSON document. Config keys
+// are lowercased when loaded, so use Body (raw JSON) when key case matters.
+type MockConfig struct {
+	Status  int               `mapstructure:"status"` // Default 200
+	JSON    interface{}       `mapstructure:"json"`
+	Body    string            `mapstructure:"body"` // Raw JSON, takes precedence over JSON
+	Headers map[string]string `mapstructure:"headers"`
+}
+
+// ComposeConfig fans a "compose" route out to several upstream calls and
+// merges their JSON responses. A call that references ${calls.<name>...} in
+// its path, body or headers waits for that call; the others run in parallel.
+type ComposeConfig struct {
+	Calls     []ComposeCallConfig `mapstructure:"calls"`
+	Response  string              `mapstructure:"response"`   // JSON template, defaults to {"<call>": <response>, ...}
+	OnError   string              `mapstructure:"on_error"`   // partial (default, failed calls render as null) or fail
+	TimeoutMs int                 `mapstructure:"timeout_ms"` // Default per-call timeout
+}
+
+type ComposeCallConfig struct {
+	Name           string            `mapstructure:"name"`
+	Upstream       string            `mapstructure:"upstream"`
+	Method         string            `mapstructure:"method"` // Default GET
+	Path           string            `mapstructure:"path"`   // Template, e.g. "/orders?user=${calls.user.id}"; values are URL-escaped
+	Body           string            `mapstructure:"body"`   // Template
+	Headers        map[string]string `mapstructure:"headers"`
+	ForwardHeaders []string          `mapstructure:"forward_headers"` // Client headers to pass on, e.g. Authorization
+	TimeoutMs      int               `mapstructure:"timeout_ms"`
 }
 
 type UpstreamConfig struct {
@@ -36,6 +354,24 @@ type UpstreamConfig struct {
 	TimeoutMs      int                  `mapstructure:"timeout_ms"`
 	Retry          RetryConfig          `mapstructure:"retry"`
 	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+	Maintenance    MaintenanceConfig    `mapstructure:"maintenance"`
+	Concurrency    ConcurrencyConfig    `mapstructure:"concurrency"` // Across all routes
+
+	AdaptiveConcurrency AdaptiveConcurrencyConfig `mapstructure:"adaptive_concurrency"`
+}
+
+// AdaptiveConcurrencyConfig sheds requests to an upstream with 503 beyond a
+// limit that is adjusted continuously from the upstream's latency against
+// its baseline. Algorithm is gradient (default) or aimd.
+type AdaptiveConcurrencyConfig struct {
+	Enabled      bool    `mapstructure:"enabled"`
+	Algorithm    string  `mapstructure:"algorithm"`
+	InitialLimit int     `mapstructure:"initial_limit"` // Default 20
+	MinLimit     int     `mapstructure:"min_limit"`     // Default 1
+	MaxLimit     int     `mapstructure:"max_limit"`     // Default 1000
+	Tolerance    float64 `mapstructure:"tolerance"`     // Latency over the baseline tolerated, default 1.5x
+	Smoothing    float64 `mapstructure:"smoothing"`     // gradient, default 0.2
+	BackoffRatio float64 `mapstructure:"backoff_ratio"` // aimd, default 0.9
 }
 
 type RetryConfig struct {
@@ -60,10 +396,69 @@ type JWTConfig struct {
 	Secret        string `mapstructure:"secret"`
 }
 
+// RateLimitConfig holds the limit tiers. Global, per-IP and per-consumer
+// limits are enforced gateway-wide before route matching; per-route limits by
+// the "ratelimit" route middleware. PerIP, PerConsumer and PerRoute count per
+// WindowSeconds; a zero limit disables its tier.
 type RateLimitConfig struct {
 	GlobalPerMinute int `mapstructure:"global_per_minute"`
 	PerIP           int `mapstructure:"per_ip"`
 	PerRoute        int `mapstructure:"per_route"`
+	PerConsumer     int `mapstructure:"per_consumer"` // Per JWT subject or API key
+
+	Algorithm     string `mapstructure:"algorithm"`      // See LimitConfig
+	WindowSeconds int    `mapstructure:"window_seconds"` // Default 60
+	Burst         int    `mapstructure:"burst"`          // For per_route
+
+	// What to do while Redis is unreachable: fail_open (default),
+	// fail_closed, or local, which limits in memory to each limit divided by
+	// Instances. The breaker stops waiting on Redis timeouts for every request.
+	FailureMode  string               `mapstructure:"failure_mode"`
+	Instances    int                  `mapstructure:"instances"` // Gateway instance count, default 1
+	RedisBreaker CircuitBreakerConfig `mapstructure:"redis_circuit_breaker"`
+
+	// Named sets of consumer limits, e.g. free, pro and enterprise. Consumers
+	// are assigned a plan at runtime through the admin API; the assignment
+	// is kept in Redis and replaces per_consumer. Consumers without one get
+	// DefaultPlan, or per_consumer if that is unset. Plan limits are keyed
+	// by consumer unless they set a key. Unnamed limits are counted by their
+	// position in the plan, so usage carries over when a consumer switches
+	// plans; named limits are counted on their own.
+	Plans               map[string][]LimitConfig `mapstructure:"plans"`
+	DefaultPlan         string                   `mapstructure:"default_plan"`
+	PlanCacheTTLSeconds int                      `mapstructure:"plan_cache_ttl_seconds"` // Default 5
+}
+
+// LimitConfig is one rate limit of Limit requests per window. Algorithm is
+// fixed_window, sliding_log, sliding_window (default), token_bucket or gcra;
+// Burst is the bucket size of token_bucket and gcra (default Limit).
+//
+// Key lists the dimensions a separate counter is kept for: route, ip,
+// method, sub, claim:<name>, header:<name>, api_key (X-API-Key) or
+// consumer (sub, else api_key). It
+// defaults to [route, ip]. Limits with the same Name share counters, so a
+// per-user limit without "route" in its key spans every route that uses it.
+type LimitConfig struct {
+	Name          string   `mapstructure:"name"` // Defaults to <route>:<index>
+	Algorithm     string   `mapstructure:"algorithm"`
+	Limit         int      `mapstructure:"limit"`
+	WindowSeconds int      `mapstructure:"window_seconds"`
+	Burst         int      `mapstructure:"burst"`
+	Key           []string `mapstructure:"key"`
+}
+
+// CostConfig weighs requests for the "ratelimit" middleware: each takes its
+// cost in tokens instead of one. The cost is Default, or the method's; a
+// Query parameter or the GraphQL query's complexity, times PerUnit, raises
+// it when present. Route limits without an algorithm then default to
+// token_bucket.
+type CostConfig struct {
+	Default int            `mapstructure:"default"`  // Default 1
+	Methods map[string]int `mapstructure:"methods"`  // e.g. {post: 10}
+	Query   string         `mapstructure:"query"`    // e.g. "limit"
+	GraphQL bool           `mapstructure:"graphql"`  // Nested fields, times first/last/limit arguments
+	PerUnit float64        `mapstructure:"per_unit"` // Default 1
+	Max     int            `mapstructure:"max"`      // At most the smallest limit's burst (or limit), the default
 }
 
 var AppConfig Config
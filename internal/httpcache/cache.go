@@ -0,0 +1,225 @@
+package httpcache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"vibeway/internal/config"
+	"vibeway/internal/metrics"
+	"vibeway/internal/middleware"
+	"vibeway/pkg/logger"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	defaultMaxBodyBytes = 1 << 20 // 1 MiB
+
+	revalidateTimeout = 30 * time.Second
+)
+
+// FetchFunc performs the upstream request. It must not use the fiber context,
+// since it also runs in the background for stale-while-revalidate.
+type FetchFunc func(req *fasthttp.Request, resp *fasthttp.Response) error
+
+// Cache is the response cache of a single route.
+type Cache struct {
+	route string
+	cfg   config.CacheConfig
+	store *Store
+	keys  keyBuilder
+
+	revalidating sync.Map // key -> struct{}
+}
+
+// New returns nil if caching is not enabled for the route.
+func New(route string, cfg config.CacheConfig, store *Store) *Cache {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &Cache{
+		route: route,
+		cfg:   cfg,
+		store: store,
+		keys:  keyBuilder{cfg: cfg.Key},
+	}
+}
+
+// Serve answers c from the cache when possible and otherwise calls fetch,
+// storing the response if it is cacheable. upstream is the upstream fetch
+// proxies to. X-Cache is set to HIT, MISS, STALE or BYPASS.
+func (rc *Cache) Serve(c fiber.Ctx, upstream string, fetch FetchFunc) error {
+	method := c.Method()
+	if method != fiber.MethodGet && method != fiber.MethodHead {
+		return fetch(c.Request(), c.Response())
+	}
+
+	reqCC := parseCacheControl(c.Request().Header.Peek(fasthttp.HeaderCacheControl))
+	if reqCC.has("no-store") {
+		err := fetch(c.Request(), c.Response())
+		rc.mark(c, "BYPASS")
+		return err
+	}
+
+	ctx := c.Context()
+	key := rc.keys.build(c, upstream)
+	now := time.Now()
+
+	entry, found := rc.store.Get(ctx, key)
+	if found && !entry.varyMatches(&c.Request().Header) {
+		entry, found = nil, false
+	}
+
+	// Client no-cache or max-age=0 forces revalidation
+	maxAge, hasMaxAge := reqCC.seconds("max-age")
+	mustRevalidate := reqCC.has("no-cache") || (hasMaxAge && maxAge == 0)
+
+	if found && !mustRevalidate {
+		if entry.fresh(now) {
+			return rc.serveEntry(c, entry, "HIT", now, &c.Request().Header)
+		}
+		if entry.withinStaleWhileRevalidate(now) {
+			rc.revalidate(c, key, entry, fetch)
+			return rc.serveEntry(c, entry, "STALE", now, &c.Request().Header)
+		}
+	}
+
+	// Keep the client's validators to answer them ourselves; upstream gets ours
+	clientReq := &fasthttp.RequestHeader{}
+	c.Request().Header.CopyTo(clientReq)
+	setValidators(c.Request(), entry)
+
+	err := fetch(c.Request(), c.Response())
+	resp := c.Response()
+
+	if err != nil || resp.StatusCode() >= fasthttp.StatusInternalServerError {
+		if found && entry.withinStaleIfError(now) {
+			middleware.Log(c).Warn("Serving stale response after upstream error", map[string]interface{}{"route": rc.route, "key": key})
+			return rc.serveEntry(c, entry, "STALE", now, clientReq)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	hasAuth := len(clientReq.Peek(fasthttp.HeaderAuthorization)) > 0 && !rc.cfg.Key.JWTSubject
+
+	if found && resp.StatusCode() == fasthttp.StatusNotModified {
+		p := responsePolicy(rc.cfg, revalidatedResponse(entry, resp), hasAuth, now)
+		if p.storable {
+			entry = entry.refresh(resp, p, now)
+			rc.store.Set(ctx, key, entry)
+		}
+		return rc.serveEntry(c, entry, "HIT", now, clientReq)
+	}
+
+	if method == fiber.MethodGet {
+		if p := responsePolicy(rc.cfg, resp, hasAuth, now); p.storable {
+			rc.store.Set(ctx, key, newEntry(resp, clientReq, p, now))
+		}
+	}
+
+	// Surrogate keys are for the cache only
+	resp.Header.Del(surrogateKeyHeader)
+
+	rc.mark(c, "MISS")
+	if resp.StatusCode() == fasthttp.StatusOK &&
+		notModified(clientReq, string(resp.Header.Peek(fasthttp.HeaderETag)), string(resp.Header.Peek(fasthttp.HeaderLastModified))) {
+		toNotModified(resp)
+	}
+	return nil
+}
+
+// serveEntry writes entry to the response, or a 304 if the validators in
+// clientReq match.
+func (rc *Cache) serveEntry(c fiber.Ctx, entry *Entry, result string, now time.Time, clientReq *fasthttp.RequestHeader) error {
+	entry.writeTo(c.Response(), now)
+	if notModified(clientReq, entry.ETag, entry.LastModified) {
+		toNotModified(c.Response())
+	}
+	rc.mark(c, result)
+	return nil
+}
+
+func (rc *Cache) mark(c fiber.Ctx, result string) {
+	c.Set("X-Cache", result)
+	metrics.CacheRequestsTotal.WithLabelValues(rc.route, result).Inc()
+}
+
+// revalidate refreshes a stale entry in the background. At most one
+// revalidation per key runs at a time.
+func (rc *Cache) revalidate(c fiber.Ctx, key string, entry *Entry, fetch FetchFunc) {
+	if _, running := rc.revalidating.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+
+	req := fasthttp.AcquireRequest()
+	c.Request().CopyTo(req)
+	hasAuth := len(req.Header.Peek(fasthttp.HeaderAuthorization)) > 0 && !rc.cfg.Key.JWTSubject
+	setValidators(req, entry)
+
+	go func() {
+		defer rc.revalidating.Delete(key)
+		defer fasthttp.ReleaseRequest(req)
+
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseResponse(resp)
+
+		ctx, cancel := context.WithTimeout(context.Background(), revalidateTimeout)
+		defer cancel()
+
+		if err := fetch(req, resp); err != nil {
+			logger.Warn("Background revalidation failed", map[string]interface{}{"route": rc.route, "key": key, "error": err.Error()})
+			return
+		}
+
+		now := time.Now()
+		if resp.StatusCode() == fasthttp.StatusNotModified {
+			if p := responsePolicy(rc.cfg, revalidatedResponse(entry, resp), hasAuth, now); p.storable {
+				rc.store.Set(ctx, key, entry.refresh(resp, p, now))
+			}
+			return
+		}
+		if p := responsePolicy(rc.cfg, resp, hasAuth, now); p.storable {
+			rc.store.Set(ctx, key, newEntry(resp, &req.Header, p, now))
+		}
+	}()
+}
+
+// setValidators replaces any client validators with the stored entry's.
+func setValidators(req *fasthttp.Request, entry *Entry) {
+	req.Header.Del(fasthttp.HeaderIfNoneMatch)
+	req.Header.Del(fasthttp.HeaderIfModifiedSince)
+	if entry == nil {
+		return
+	}
+	if entry.ETag != "" {
+		req.Header.Set(fasthttp.HeaderIfNoneMatch, entry.ETag)
+	} else if entry.LastModified != "" {
+		req.Header.Set(fasthttp.HeaderIfModifiedSince, entry.LastModified)
+	}
+}
+
+// revalidatedResponse builds the response a 304 stands for: the stored
+// entry updated with the 304's headers, so the storage policy can be applied.
+func revalidatedResponse(entry *Entry, notModified *fasthttp.Response) *fasthttp.Response {
+	resp := &fasthttp.Response{}
+	resp.SetStatusCode(entry.Status)
+	for _, h := range entry.Header {
+		resp.Header.Add(h[0], h[1])
+	}
+	for k, v := range notModified.Header.All() {
+		resp.Header.Set(string(k), string(v))
+	}
+	resp.SetBody(entry.Body)
+	return resp
+}
+
+func maxBodyBytes(cfg config.CacheConfig) int {
+	if cfg.MaxBodyBytes > 0 {
+		return cfg.MaxBodyBytes
+	}
+	return defaultMaxBodyBytes
+}
@@ -0,0 +1,138 @@
+package httpcache
+
+import (
+	"sync"
+	"time"
+
+	"vibeway/internal/config"
+	"vibeway/internal/metrics"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/valyala/fasthttp"
+)
+
+const defaultCoalesceMaxWait = 5 * time.Second
+
+// flight is one in-progress upstream call that others may wait on.
+type flight struct {
+	done      chan struct{}
+	mu        sync.Mutex // Guards reads of resp while followers copy it
+	resp      *fasthttp.Response
+	err       error
+	shareable bool
+}
+
+// Coalescer collapses concurrent identical GET and HEAD requests of a route
+// into a single upstream call whose response is shared by all waiters.
+type Coalescer struct {
+	route   string
+	maxWait time.Duration
+	keys    keyBuilder
+
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// NewCoalescer returns nil if coalescing is not enabled for the route.
+func NewCoalescer(route string, cfg config.CoalesceConfig) *Coalescer {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	maxWait := time.Duration(cfg.MaxWaitMs) * time.Millisecond
+	if maxWait <= 0 {
+		maxWait = defaultCoalesceMaxWait
+	}
+
+	return &Coalescer{
+		route:   route,
+		maxWait: maxWait,
+		// Identical means same method, full URL, selected headers and identity
+		keys: keyBuilder{cfg: config.CacheKeyConfig{
+			QueryParams: []string{"*"},
+			Headers:     append([]string{fasthttp.HeaderAuthorization}, cfg.Headers...),
+			JWTSubject:  true,
+		}},
+		flights: make(map[string]*flight),
+	}
+}
+
+// Wrap returns a fetch function that joins an identical in-flight call to
+// the same upstream when there is one. Waiters give up after the maximum wait
+// and fetch on their own, as they do when the shared response turns out to be
+// private.
+func (co *Coalescer) Wrap(c fiber.Ctx, upstream string, fetch FetchFunc) FetchFunc {
+	if c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead {
+		return fetch
+	}
+	// HEAD shares the key space with GET in keyBuilder; keep them apart here
+	base := c.Method() + " " + co.keys.build(c, upstream)
+
+	return func(req *fasthttp.Request, resp *fasthttp.Response) error {
+		// Conditional requests (e.g. cache revalidation) only match their own kind
+		key := base + "|" + string(req.Header.Peek(fasthttp.HeaderIfNoneMatch)) +
+			"|" + string(req.Header.Peek(fasthttp.HeaderIfModifiedSince))
+
+		co.mu.Lock()
+		if f, ok := co.flights[key]; ok {
+			co.mu.Unlock()
+			return co.wait(f, fetch, req, resp)
+		}
+		f := &flight{done: make(chan struct{})}
+		co.flights[key] = f
+		co.mu.Unlock()
+
+		err := fetch(req, resp)
+
+		f.err = err
+		if err == nil && shareable(resp) {
+			f.resp = &fasthttp.Response{}
+			resp.CopyTo(f.resp)
+			f.shareable = true
+		}
+
+		co.mu.Lock()
+		delete(co.flights, key)
+		co.mu.Unlock()
+		close(f.done)
+
+		metrics.CoalescedRequestsTotal.WithLabelValues(co.route, "leader").Inc()
+		return err
+	}
+}
+
+func (co *Coalescer) wait(f *flight, fetch FetchFunc, req *fasthttp.Request, resp *fasthttp.Response) error {
+	timer := time.NewTimer(co.maxWait)
+	defer timer.Stop()
+
+	select {
+	case <-f.done:
+	case <-timer.C:
+		metrics.CoalescedRequestsTotal.WithLabelValues(co.route, "timeout").Inc()
+		return fetch(req, resp)
+	}
+
+	if f.err != nil {
+		metrics.CoalescedRequestsTotal.WithLabelValues(co.route, "shared").Inc()
+		return f.err
+	}
+	if !f.shareable {
+		metrics.CoalescedRequestsTotal.WithLabelValues(co.route, "private").Inc()
+		return fetch(req, resp)
+	}
+
+	f.mu.Lock()
+	f.resp.CopyTo(resp)
+	f.mu.Unlock()
+	metrics.CoalescedRequestsTotal.WithLabelValues(co.route, "shared").Inc()
+	return nil
+}
+
+// shareable reports whether a response may be handed to other clients.
+func shareable(resp *fasthttp.Response) bool {
+	if len(resp.Header.Peek(fasthttp.HeaderSetCookie)) > 0 {
+		return false
+	}
+	cc := parseCacheControl(resp.Header.Peek(fasthttp.HeaderCacheControl))
+	return !cc.has("private") && !cc.has("no-store")
+}
@@ -0,0 +1,177 @@
+package httpcache
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Entry is a stored response together with its freshness information.
+type Entry struct {
+	Status int         `json:"status"`
+	Header [][2]string `json:"header"`
+	Body   []byte      `json:"body"`
+
+	StoredAt             time.Time     `json:"stored_at"`
+	FreshUntil           time.Time     `json:"fresh_until"`
+	StaleWhileRevalidate time.Duration `json:"stale_while_revalidate"`
+	StaleIfError         time.Duration `json:"stale_if_error"`
+
+	ETag         string            `json:"etag,omitempty"`
+	LastModified string            `json:"last_modified,omitempty"`
+	Vary         map[string]string `json:"vary,omitempty"` // Request header values the entry was stored for
+	Tags         []string          `json:"tags,omitempty"` // Surrogate keys for purging
+}
+
+// skipStoredHeaders are never replayed from the cache.
+var skipStoredHeaders = map[string]bool{
+	"Set-Cookie":    true,
+	"Surrogate-Key": true,
+	"Age":           true,
+	"X-Cache":       true,
+	"Connection":    true,
+}
+
+func newEntry(resp *fasthttp.Response, req *fasthttp.RequestHeader, p policy, now time.Time) *Entry {
+	e := &Entry{
+		Status:               resp.StatusCode(),
+		Body:                 append([]byte(nil), resp.Body()...),
+		StoredAt:             now,
+		FreshUntil:           now.Add(p.ttl),
+		StaleWhileRevalidate: p.staleWhileRevalidate,
+		StaleIfError:         p.staleIfError,
+		ETag:                 string(resp.Header.Peek(fasthttp.HeaderETag)),
+		LastModified:         string(resp.Header.Peek(fasthttp.HeaderLastModified)),
+		Tags:                 strings.Fields(string(resp.Header.Peek(surrogateKeyHeader))),
+	}
+
+	for k, v := range resp.Header.All() {
+		name := string(k)
+		if skipStoredHeaders[name] {
+			continue
+		}
+		e.Header = append(e.Header, [2]string{name, string(v)})
+	}
+
+	if len(p.vary) > 0 {
+		e.Vary = make(map[string]string, len(p.vary))
+		for _, name := range p.vary {
+			e.Vary[name] = string(req.Peek(name))
+		}
+	}
+	return e
+}
+
+// hasTag reports whether the entry carries the surrogate key tag.
+func (e *Entry) hasTag(tag string) bool {
+	for _, t := range e.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Entry) size() int {
+	n := len(e.Body)
+	for _, h := range e.Header {
+		n += len(h[0]) + len(h[1])
+	}
+	return n
+}
+
+func (e *Entry) fresh(now time.Time) bool {
+	return now.Before(e.FreshUntil)
+}
+
+func (e *Entry) withinStaleWhileRevalidate(now time.Time) bool {
+	return now.Before(e.FreshUntil.Add(e.StaleWhileRevalidate))
+}
+
+func (e *Entry) withinStaleIfError(now time.Time) bool {
+	return now.Before(e.FreshUntil.Add(e.StaleIfError))
+}
+
+// expiresAt is when the entry becomes useless even as a stale fallback.
+func (e *Entry) expiresAt() time.Time {
+	return e.FreshUntil.Add(max(e.StaleWhileRevalidate, e.StaleIfError))
+}
+
+// varyMatches reports whether the request carries the same values for the
+// headers named in the stored response's Vary header.
+func (e *Entry) varyMatches(req *fasthttp.RequestHeader) bool {
+	for name, v := range e.Vary {
+		if string(req.Peek(name)) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// refresh applies a 304 revalidation: the stored body is kept and freshness
+// restarts from the new response headers.
+func (e *Entry) refresh(resp *fasthttp.Response, p policy, now time.Time) *Entry {
+	refreshed := *e
+	refreshed.StoredAt = now
+	refreshed.FreshUntil = now.Add(p.ttl)
+	refreshed.StaleWhileRevalidate = p.staleWhileRevalidate
+	refreshed.StaleIfError = p.staleIfError
+	if etag := resp.Header.Peek(fasthttp.HeaderETag); len(etag) > 0 {
+		refreshed.ETag = string(etag)
+	}
+	return &refreshed
+}
+
+// writeTo replaces resp with the stored response.
+func (e *Entry) writeTo(resp *fasthttp.Response, now time.Time) {
+	resp.Reset()
+	resp.SetStatusCode(e.Status)
+	for _, h := range e.Header {
+		resp.Header.Add(h[0], h[1])
+	}
+	resp.SetBody(e.Body)
+	resp.Header.Set("Age", strconv.Itoa(int(now.Sub(e.StoredAt).Seconds())))
+}
+
+// notModified reports whether the client's conditional headers match the
+// entry, so a 304 can be sent instead of the body.
+func notModified(req *fasthttp.RequestHeader, etag, lastModified string) bool {
+	if inm := string(req.Peek(fasthttp.HeaderIfNoneMatch)); inm != "" {
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || weakETag(candidate) == weakETag(etag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := string(req.Peek(fasthttp.HeaderIfModifiedSince)); ims != "" && lastModified != "" {
+		since, err := time.Parse(time.RFC1123, ims)
+		if err != nil {
+			return false
+		}
+		modified, err := time.Parse(time.RFC1123, lastModified)
+		return err == nil && !modified.After(since)
+	}
+	return false
+}
+
+// weakETag strips the weak validator prefix; If-None-Match uses weak comparison.
+func weakETag(tag string) string {
+	return strings.TrimPrefix(tag, "W/")
+}
+
+// toNotModified turns a full response into a 304 that keeps its validators
+// and caching headers.
+func toNotModified(resp *fasthttp.Response) {
+	resp.SetStatusCode(fasthttp.StatusNotModified)
+	resp.ResetBody()
+	resp.Header.Del(fasthttp.HeaderContentType)
+	resp.Header.Del(fasthttp.HeaderContentEncoding)
+}
@@ -0,0 +1,76 @@
+package httpcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"vibeway/internal/config"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// keyBuilder derives cache keys of the form
+// "vibeway:cache:<METHOD>:<path>#<hash>", where the hash covers the upstream
+// the request is routed to, the selected query params, headers and JWT
+// subject. Keeping the path readable allows purging by path prefix.
+type keyBuilder struct {
+	cfg config.CacheKeyConfig
+}
+
+// build returns the key of c, which is proxied to upstream. Variants behind
+// a split or routing rule answer the same URL differently.
+func (kb keyBuilder) build(c fiber.Ctx, upstream string) string {
+	method := c.Method()
+	if method == fiber.MethodHead {
+		// HEAD is answered from GET entries
+		method = fiber.MethodGet
+	}
+
+	var b strings.Builder
+	b.WriteString(upstream)
+	b.WriteByte('|')
+
+	args := c.Request().URI().QueryArgs()
+
+	if len(kb.cfg.QueryParams) == 1 && kb.cfg.QueryParams[0] == "*" {
+		var pairs []string
+		for k, v := range args.All() {
+			pairs = append(pairs, string(k)+"="+string(v))
+		}
+		sort.Strings(pairs)
+		b.WriteString(strings.Join(pairs, "&"))
+	} else {
+		for _, name := range kb.cfg.QueryParams {
+			b.WriteString(name)
+			b.WriteByte('=')
+			for _, v := range args.PeekMulti(name) {
+				b.Write(v)
+				b.WriteByte(',')
+			}
+			b.WriteByte('&')
+		}
+	}
+	b.WriteByte('|')
+
+	for _, name := range kb.cfg.Headers {
+		b.WriteString(strings.ToLower(name))
+		b.WriteByte('=')
+		b.Write(c.Request().Header.Peek(name))
+		b.WriteByte('&')
+	}
+	b.WriteByte('|')
+
+	if kb.cfg.JWTSubject {
+		if claims, ok := c.Locals("claims").(jwt.MapClaims); ok {
+			if sub, err := claims.GetSubject(); err == nil {
+				b.WriteString(sub)
+			}
+		}
+	}
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return keyPrefix + method + ":" + c.Path() + "#" + hex.EncodeToString(sum[:8])
+}
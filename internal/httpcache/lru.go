@@ -0,0 +1,98 @@
+package httpcache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lru is a memory tier bounded by both entry count and total body size.
+type lru struct {
+	maxEntries int
+	maxBytes   int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	bytes int
+}
+
+type lruItem struct {
+	key   string
+	entry *Entry
+	size  int
+}
+
+func newLRU(maxEntries, maxBytes int) *lru {
+	return &lru{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (l *lru) get(key string) (*Entry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	l.ll.MoveToFront(el)
+	return el.Value.(*lruItem).entry, true
+}
+
+func (l *lru) add(key string, e *Entry) {
+	size := e.size()
+	if size > l.maxBytes {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.items[key]; ok {
+		item := el.Value.(*lruItem)
+		l.bytes += size - item.size
+		item.entry, item.size = e, size
+		l.ll.MoveToFront(el)
+	} else {
+		l.items[key] = l.ll.PushFront(&lruItem{key: key, entry: e, size: size})
+		l.bytes += size
+	}
+
+	for l.ll.Len() > l.maxEntries || l.bytes > l.maxBytes {
+		l.removeElement(l.ll.Back())
+	}
+}
+
+func (l *lru) remove(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.items[key]; ok {
+		l.removeElement(el)
+	}
+}
+
+func (l *lru) removeElement(el *list.Element) {
+	item := l.ll.Remove(el).(*lruItem)
+	delete(l.items, item.key)
+	l.bytes -= item.size
+}
+
+// removeMatching drops every entry for which match returns true.
+func (l *lru) removeMatching(match func(key string, e *Entry) bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for el := l.ll.Front(); el != nil; {
+		next := el.Next()
+		item := el.Value.(*lruItem)
+		if match(item.key, item.entry) {
+			l.removeElement(el)
+		}
+		el = next
+	}
+}
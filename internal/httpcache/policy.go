@@ -0,0 +1,133 @@
+package httpcache
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"vibeway/internal/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+// cacheableStatus lists the status codes a shared cache may store.
+var cacheableStatus = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 308: true, 404: true, 410: true,
+}
+
+// directives is a parsed Cache-Control header. Flags map to "".
+type directives map[string]string
+
+func parseCacheControl(v []byte) directives {
+	d := directives{}
+	for _, part := range strings.Split(string(v), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(part, "=")
+		d[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return d
+}
+
+func (d directives) has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+func (d directives) seconds(name string) (time.Duration, bool) {
+	v, ok := d[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// policy is the storage decision for a single upstream response.
+type policy struct {
+	storable             bool
+	ttl                  time.Duration
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+	vary                 []string
+}
+
+// responsePolicy decides whether and for how long resp may be stored.
+// hasAuth reports that the request was authenticated and the cache key does
+// not separate users, in which case only explicitly shareable responses are
+// stored.
+func responsePolicy(cfg config.CacheConfig, resp *fasthttp.Response, hasAuth bool, now time.Time) policy {
+	if !cacheableStatus[resp.StatusCode()] {
+		return policy{}
+	}
+	if len(resp.Header.Peek(fasthttp.HeaderSetCookie)) > 0 {
+		return policy{}
+	}
+	if len(resp.Body()) > maxBodyBytes(cfg) {
+		return policy{}
+	}
+
+	cc := parseCacheControl(resp.Header.Peek(fasthttp.HeaderCacheControl))
+	if cc.has("no-store") || cc.has("private") {
+		return policy{}
+	}
+	if hasAuth && !cc.has("public") && !cc.has("s-maxage") && !cc.has("must-revalidate") {
+		return policy{}
+	}
+
+	p := policy{storable: true}
+
+	for _, v := range strings.Split(string(resp.Header.Peek(fasthttp.HeaderVary)), ",") {
+		if v = strings.TrimSpace(v); v == "*" {
+			return policy{}
+		} else if v != "" {
+			p.vary = append(p.vary, v)
+		}
+	}
+
+	switch ttl, ok := cc.seconds("s-maxage"); {
+	case ok:
+		p.ttl = ttl
+	case cc.has("max-age"):
+		p.ttl, _ = cc.seconds("max-age")
+	default:
+		if expires := resp.Header.Peek(fasthttp.HeaderExpires); len(expires) > 0 {
+			// Invalid Expires values (e.g. "0") mean already expired
+			if t, err := time.Parse(time.RFC1123, string(expires)); err == nil {
+				date := now
+				if d, err := time.Parse(time.RFC1123, string(resp.Header.Peek(fasthttp.HeaderDate))); err == nil {
+					date = d
+				}
+				p.ttl = max(t.Sub(date), 0)
+			}
+		} else if cfg.DefaultTTLSeconds > 0 {
+			p.ttl = time.Duration(cfg.DefaultTTLSeconds) * time.Second
+		} else {
+			return policy{}
+		}
+	}
+
+	// no-cache responses may be stored but must be revalidated every time
+	if cc.has("no-cache") {
+		p.ttl = 0
+	}
+
+	p.staleWhileRevalidate = time.Duration(cfg.StaleWhileRevalidateSeconds) * time.Second
+	if swr, ok := cc.seconds("stale-while-revalidate"); ok {
+		p.staleWhileRevalidate = swr
+	}
+	p.staleIfError = time.Duration(cfg.StaleIfErrorSeconds) * time.Second
+	if sie, ok := cc.seconds("stale-if-error"); ok {
+		p.staleIfError = sie
+	}
+	if cc.has("must-revalidate") || cc.has("proxy-revalidate") {
+		p.staleWhileRevalidate, p.staleIfError = 0, 0
+	}
+
+	return p
+}
@@ -0,0 +1,193 @@
+package httpcache
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"vibeway/internal/middleware"
+	"vibeway/pkg/logger"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+const (
+	surrogateKeyHeader = "Surrogate-Key"
+
+	// purgeChannel tells every gateway instance to drop purged entries from
+	// its memory tier; the Redis tier is shared and purged once.
+	purgeChannel = "vibeway:cache:purge"
+
+	purgeScanCount = 500
+)
+
+// PurgeRequest selects entries to invalidate. Key is an exact cache key,
+// Path a request path glob such as "/api/v1/users/*" ("*" also spans "/",
+// so a trailing "*" purges a whole prefix), and Tags are
+// surrogate keys sent by upstreams in the Surrogate-Key header.
+type PurgeRequest struct {
+	Key  string   `json:"key,omitempty"`
+	Path string   `json:"path,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+func (pr PurgeRequest) empty() bool {
+	return pr.Key == "" && pr.Path == "" && len(pr.Tags) == 0
+}
+
+// Purge removes matching entries from Redis and tells all instances,
+// including this one, to drop them from memory. It returns the number of
+// Redis keys removed.
+func (s *Store) Purge(ctx context.Context, pr PurgeRequest) (int64, error) {
+	s.purgeMemory(pr)
+
+	if s.redis == nil {
+		return 0, nil
+	}
+
+	var keys []string
+	if pr.Key != "" {
+		keys = append(keys, pr.Key)
+	}
+
+	if pr.Path != "" {
+		// Keys look like vibeway:cache:<METHOD>:<path>#<hash>
+		iter := s.redis.Scan(ctx, 0, keyPrefix+"*:"+pr.Path+"#*", purgeScanCount).Iterator()
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+		}
+		if err := iter.Err(); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, tag := range pr.Tags {
+		members, err := s.redis.SMembers(ctx, tagKeyPrefix+tag).Result()
+		if err != nil {
+			return 0, err
+		}
+		keys = append(keys, members...)
+		keys = append(keys, tagKeyPrefix+tag)
+	}
+
+	var purged int64
+	if len(keys) > 0 {
+		n, err := s.redis.Del(ctx, keys...).Result()
+		if err != nil {
+			return 0, err
+		}
+		purged = n
+	}
+
+	msg, _ := json.Marshal(pr)
+	if err := s.redis.Publish(ctx, purgeChannel, msg).Err(); err != nil {
+		logger.Warn("Failed to broadcast cache purge", map[string]interface{}{"error": err.Error()})
+	}
+	return purged, nil
+}
+
+func (s *Store) purgeMemory(pr PurgeRequest) {
+	s.mem.removeMatching(func(key string, e *Entry) bool {
+		if pr.Key != "" && key == pr.Key {
+			return true
+		}
+		if pr.Path != "" {
+			if p, ok := keyPath(key); ok {
+				if globMatch(pr.Path, p) {
+					return true
+				}
+			}
+		}
+		for _, tag := range pr.Tags {
+			if e.hasTag(tag) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// keyPath extracts the request path from a cache key.
+func keyPath(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, keyPrefix)
+	if !ok {
+		return "", false
+	}
+	_, rest, ok = strings.Cut(rest, ":")
+	if !ok {
+		return "", false
+	}
+	i := strings.LastIndexByte(rest, '#')
+	if i == -1 {
+		return "", false
+	}
+	return rest[:i], true
+}
+
+// globMatch matches like Redis SCAN MATCH: "*" spans any characters,
+// including "/", and "?" matches exactly one.
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if globMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return s == ""
+}
+
+// subscribePurges applies purges broadcast by other instances to the memory
+// tier, resubscribing if the connection drops.
+func (s *Store) subscribePurges() {
+	for {
+		sub := s.redis.Subscribe(context.Background(), purgeChannel)
+		for msg := range sub.Channel() {
+			var pr PurgeRequest
+			if err := json.Unmarshal([]byte(msg.Payload), &pr); err != nil || pr.empty() {
+				continue
+			}
+			s.purgeMemory(pr)
+		}
+		_ = sub.Close()
+		time.Sleep(time.Second)
+	}
+}
+
+// RegisterAdmin exposes POST /cache/purge on the admin API.
+func RegisterAdmin(r fiber.Router, s *Store) {
+	r.Post("/cache/purge", func(c fiber.Ctx) error {
+		var pr PurgeRequest
+		if err := c.Bind().JSON(&pr); err != nil || pr.empty() {
+			return middleware.ErrorJSON(c, fiber.StatusBadRequest, "Body must contain key, path or tags")
+		}
+
+		purged, err := s.Purge(c.Context(), pr)
+		if err != nil {
+			middleware.Log(c).Error("Cache purge failed", err, nil)
+			return middleware.ErrorJSON(c, fiber.StatusBadGateway, "Cache purge failed")
+		}
+
+		middleware.Log(c).Info("Cache purged", map[string]interface{}{
+			"key":    pr.Key,
+			"path":   pr.Path,
+			"tags":   pr.Tags,
+			"purged": purged,
+		})
+		return c.JSON(fiber.Map{"purged": purged})
+	})
+}
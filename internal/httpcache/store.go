@@ -0,0 +1,136 @@
+package httpcache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"vibeway/internal/config"
+	"vibeway/pkg/logger"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultMemoryMaxEntries = 10000
+	defaultMemoryMaxBytes   = 64 << 20
+
+	keyPrefix    = "vibeway:cache:"
+	tagKeyPrefix = "vibeway:cache-tag:"
+
+	// validatorRetention keeps entries with an ETag or Last-Modified around
+	// after they go stale, so they can be revalidated with a cheap 304.
+	validatorRetention = 10 * time.Minute
+)
+
+// Store is a two-tier response store: a bounded in-process LRU in front of
+// Redis, which is shared by all gateway instances.
+type Store struct {
+	mem   *lru
+	redis *redis.Client
+}
+
+func NewStore(cfg config.ResponseCacheConfig, client *redis.Client) *Store {
+	maxEntries := cfg.MemoryMaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultMemoryMaxEntries
+	}
+	maxBytes := cfg.MemoryMaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultMemoryMaxBytes
+	}
+
+	s := &Store{
+		mem:   newLRU(maxEntries, maxBytes),
+		redis: client,
+	}
+	if client != nil {
+		go s.subscribePurges()
+	}
+	return s
+}
+
+// Get looks the key up in memory first, then in Redis. Redis errors are
+// treated as misses.
+func (s *Store) Get(ctx context.Context, key string) (*Entry, bool) {
+	now := time.Now()
+
+	if e, ok := s.mem.get(key); ok {
+		if now.Before(retainUntil(e)) {
+			return e, true
+		}
+		s.mem.remove(key)
+	}
+
+	if s.redis == nil {
+		return nil, false
+	}
+
+	data, err := s.redis.Get(ctx, key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			logger.Warn("Response cache redis read failed", map[string]interface{}{"key": key, "error": err.Error()})
+		}
+		return nil, false
+	}
+
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, false
+	}
+	s.mem.add(key, &e)
+	return &e, true
+}
+
+// Set stores the entry in both tiers until it is no longer usable.
+func (s *Store) Set(ctx context.Context, key string, e *Entry) {
+	ttl := time.Until(retainUntil(e))
+	if ttl <= 0 {
+		return
+	}
+
+	s.mem.add(key, e)
+
+	if s.redis == nil {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	// Index the entry under its surrogate keys so it can be purged by tag
+	_, err = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, data, ttl)
+		for _, tag := range e.Tags {
+			tagKey := tagKeyPrefix + tag
+			pipe.SAdd(ctx, tagKey, key)
+			pipe.ExpireNX(ctx, tagKey, ttl)
+			pipe.ExpireGT(ctx, tagKey, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Warn("Response cache redis write failed", map[string]interface{}{"key": key, "error": err.Error()})
+	}
+}
+
+// Delete removes keys from both tiers.
+func (s *Store) Delete(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		s.mem.remove(key)
+	}
+	if s.redis == nil || len(keys) == 0 {
+		return nil
+	}
+	return s.redis.Del(ctx, keys...).Err()
+}
+
+func retainUntil(e *Entry) time.Time {
+	until := e.expiresAt()
+	if e.ETag != "" || e.LastModified != "" {
+		until = until.Add(validatorRetention)
+	}
+	return until
+}
@@ -36,6 +36,109 @@ var (
 			Name: "gateway_rate_limit_hits_total",
 			Help: "The total number of rate limit hits",
 		},
-		[]string{"route", "ip"},
+		[]string{"route", "ip", "tier"},
+	)
+
+	MirrorRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_mirror_requests_total",
+			Help: "The total number of mirrored requests by outcome",
+		},
+		[]string{"route", "upstream", "result"},
+	)
+
+	VariantRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_variant_requests_total",
+			Help: "The total number of requests routed to each traffic split variant",
+		},
+		[]string{"route", "variant"},
+	)
+
+	FaultInjectionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_fault_injections_total",
+			Help: "The total number of injected faults (chaos testing, not real errors)",
+		},
+		[]string{"route", "type"},
+	)
+
+	CacheRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_cache_requests_total",
+			Help: "The total number of cacheable requests by cache result",
+		},
+		[]string{"route", "result"},
+	)
+
+	CoalescedRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_coalesced_requests_total",
+			Help: "The total number of coalescing-enabled requests by role (leader, shared, private, timeout)",
+		},
+		[]string{"route", "result"},
+	)
+
+	RateLimiterMode = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_rate_limiter_mode",
+			Help: "1 for the mode the rate limiter currently runs in (redis, local, fail_open, fail_closed)",
+		},
+		[]string{"mode"},
+	)
+
+	QuotaExceededTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_quota_exceeded_total",
+			Help: "The total number of requests rejected by an exhausted consumer quota",
+		},
+		[]string{"quota"},
+	)
+
+	ConcurrencyRejectedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_concurrency_rejected_total",
+			Help: "The total number of requests rejected by a concurrency limit, by reason (queue_full, timeout)",
+		},
+		[]string{"limiter", "reason"},
+	)
+
+	AdaptiveConcurrencyLimit = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_adaptive_concurrency_limit",
+			Help: "The current adaptive in-flight request limit of each upstream",
+		},
+		[]string{"upstream"},
+	)
+
+	AdaptiveConcurrencyShedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_adaptive_concurrency_shed_total",
+			Help: "The total number of requests shed by an upstream's adaptive concurrency limit",
+		},
+		[]string{"upstream"},
+	)
+
+	LoadShedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_load_shed_total",
+			Help: "The total number of requests shed under overload, by scope (gateway or upstream) and criticality class",
+		},
+		[]string{"scope", "class"},
+	)
+
+	InvalidTokensTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "gateway_invalid_tokens_total",
+			Help: "The total number of bearer tokens that failed validation in checks ahead of the JWT middleware",
+		},
+	)
+
+	RateLimitCostTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_rate_limit_cost_total",
+			Help: "The total rate limit cost of allowed requests on cost-weighted routes, by consumer",
+		},
+		[]string{"route", "consumer"},
 	)
 )
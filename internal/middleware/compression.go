@@ -0,0 +1,271 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"vibeway/internal/config"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gofiber/fiber/v3"
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	defaultCompressionMinBytes = 1024
+	defaultDecompressMaxBytes  = 10 << 20
+)
+
+var (
+	defaultEncodings = []string{"br", "zstd", "gzip"}
+
+	defaultCompressibleTypes = []string{
+		"text/*",
+		"application/json",
+		"application/problem+json",
+		"application/javascript",
+		"application/xml",
+		"image/svg+xml",
+	}
+
+	errBodyTooLarge = errors.New("decoded body exceeds limit")
+)
+
+// Compression encodes responses with the best encoding the client accepts.
+// Small bodies, content types outside the allowlist, responses the upstream
+// already encoded and no-transform responses are left as they are.
+func Compression(cfg config.CompressionConfig) fiber.Handler {
+	encodings := cfg.Encodings
+	if len(encodings) == 0 {
+		encodings = defaultEncodings
+	}
+	minBytes := cfg.MinBytes
+	if minBytes <= 0 {
+		minBytes = defaultCompressionMinBytes
+	}
+	types := cfg.ContentTypes
+	if len(types) == 0 {
+		types = defaultCompressibleTypes
+	}
+
+	return func(c fiber.Ctx) error {
+		err := c.Next()
+		if err != nil || c.Method() == fiber.MethodHead {
+			return err
+		}
+
+		resp := c.Response()
+		if resp.IsBodyStream() || len(resp.Header.ContentEncoding()) > 0 {
+			return nil
+		}
+		if status := resp.StatusCode(); status < 200 || status == fiber.StatusNoContent ||
+			status == fiber.StatusPartialContent || status == fiber.StatusNotModified {
+			return nil
+		}
+		if !compressible(string(resp.Header.ContentType()), types) ||
+			strings.Contains(string(resp.Header.Peek(fiber.HeaderCacheControl)), "no-transform") {
+			return nil
+		}
+
+		if !strings.Contains(strings.ToLower(string(resp.Header.Peek(fiber.HeaderVary))), "accept-encoding") {
+			resp.Header.Add(fiber.HeaderVary, fiber.HeaderAcceptEncoding)
+		}
+		if len(resp.Body()) < minBytes {
+			return nil
+		}
+		encoding := negotiateEncoding(c.Get(fiber.HeaderAcceptEncoding), encodings)
+		if encoding == "" {
+			return nil
+		}
+
+		body := resp.Body()
+		var encoded []byte
+		switch encoding {
+		case "br":
+			encoded = fasthttp.AppendBrotliBytes(nil, body)
+		case "zstd":
+			encoded = fasthttp.AppendZstdBytes(nil, body)
+		case "gzip":
+			encoded = fasthttp.AppendGzipBytes(nil, body)
+		}
+		if len(encoded) >= len(body) {
+			return nil
+		}
+
+		resp.SetBodyRaw(encoded)
+		resp.Header.SetContentEncoding(encoding)
+		resp.Header.SetContentLength(len(encoded))
+
+		// The encoded representation is no longer byte-identical
+		if etag := resp.Header.Peek(fiber.HeaderETag); len(etag) > 0 && !bytes.HasPrefix(etag, []byte("W/")) {
+			resp.Header.Set(fiber.HeaderETag, "W/"+string(etag))
+		}
+		return nil
+	}
+}
+
+// compressible matches a Content-Type against the allowlist; "type/*"
+// entries match every subtype.
+func compressible(contentType string, allowed []string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == "" {
+		return false
+	}
+	for _, a := range allowed {
+		if prefix, ok := strings.CutSuffix(a, "*"); ok {
+			if strings.HasPrefix(mediaType, prefix) {
+				return true
+			}
+		} else if mediaType == a {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding picks the supported encoding with the highest q-value in
+// Accept-Encoding, breaking ties by the configured preference order.
+func negotiateEncoding(acceptEncoding string, supported []string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+
+	q := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		weight := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				weight = f
+			}
+		}
+		if name == "*" {
+			wildcard = weight
+		} else {
+			q[name] = weight
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range supported {
+		weight, ok := q[enc]
+		if !ok {
+			weight = wildcard
+		}
+		if weight > bestQ {
+			best, bestQ = enc, weight
+		}
+	}
+	return best
+}
+
+// Decompression decodes request bodies sent with Content-Encoding so
+// upstreams receive plain bodies. Decoding stops at MaxBytes to defuse
+// decompression bombs.
+func Decompression(cfg config.RequestDecompressionConfig) fiber.Handler {
+	maxBytes := cfg.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultDecompressMaxBytes
+	}
+
+	return func(c fiber.Ctx) error {
+		header := strings.TrimSpace(string(c.Request().Header.ContentEncoding()))
+		if header == "" || strings.EqualFold(header, "identity") {
+			return c.Next()
+		}
+
+		// Codings are listed in the order they were applied
+		codings := strings.Split(header, ",")
+		// c.Body() would decode on its own without a size limit
+		body := c.Request().Body()
+		for i := len(codings) - 1; i >= 0; i-- {
+			coding := strings.ToLower(strings.TrimSpace(codings[i]))
+			decoded, err := decode(coding, body, maxBytes)
+			if err != nil {
+				switch {
+				case errors.Is(err, errBodyTooLarge):
+					Log(c).Warn("Decoded request body too large", map[string]interface{}{
+						"encoding": header,
+						"limit":    maxBytes,
+					})
+					return ErrorJSON(c, fiber.StatusRequestEntityTooLarge, "Decoded request body too large")
+				case errors.Is(err, errors.ErrUnsupported):
+					return ErrorJSON(c, fiber.StatusUnsupportedMediaType, "Unsupported Content-Encoding")
+				default:
+					return ErrorJSON(c, fiber.StatusBadRequest, "Malformed request body encoding")
+				}
+			}
+			body = decoded
+		}
+
+		c.Request().SetBody(body)
+		c.Request().Header.Del(fiber.HeaderContentEncoding)
+		return c.Next()
+	}
+}
+
+func decode(coding string, body []byte, maxBytes int) ([]byte, error) {
+	var r io.Reader
+	switch coding {
+	case "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	case "deflate":
+		// "deflate" means zlib-wrapped, but some clients send raw deflate
+		zr, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			fr := flate.NewReader(bytes.NewReader(body))
+			defer fr.Close()
+			r = fr
+			break
+		}
+		defer zr.Close()
+		r = zr
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(body))
+	case "zstd":
+		// Bound the decoder's window and buffers too, not just its output.
+		// zstd windows cannot be smaller than 1KB.
+		limit := uint64(max(maxBytes, zstd.MinWindowSize))
+		zr, err := zstd.NewReader(bytes.NewReader(body),
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(limit),
+			zstd.WithDecoderMaxWindow(limit))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, fmt.Errorf("content encoding %q: %w", coding, errors.ErrUnsupported)
+	}
+
+	decoded, err := io.ReadAll(io.LimitReader(r, int64(maxBytes)+1))
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+		return nil, errBodyTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) > maxBytes {
+		return nil, errBodyTooLarge
+	}
+	return decoded, nil
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+
+	"vibeway/internal/concurrency"
+	"vibeway/internal/config"
+	"vibeway/internal/metrics"
+	"vibeway/internal/ratelimit"
+	"vibeway/pkg/logger"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Concurrency caps the in-flight requests of a route, in total or per
+// consumer (JWT subject, else API key).
+func Concurrency(l *concurrency.Limiter, jwtCfg config.JWTConfig) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		var key string
+		if l.Key() == concurrency.KeyConsumer {
+			claims, _ := bearerClaims(c, jwtCfg)
+			key = dimensionValues(c, "", claims)(ratelimit.DimConsumer)
+		}
+		return WithConcurrency(c, l, key, c.Next)
+	}
+}
+
+// WithConcurrency runs next while holding one of l's slots under key. If the
+// slots cannot be counted, the request is let through.
+func WithConcurrency(c fiber.Ctx, l *concurrency.Limiter, key string, next func() error) error {
+	release, err := AcquireConcurrency(c.Context(), l, key, Log(c))
+	if err != nil {
+		return err
+	}
+	defer release()
+	return next()
+}
+
+// AcquireConcurrency takes one of l's slots under key, for callers without a
+// fiber context. Requests over the limit get a *RejectError; if the slots
+// cannot be counted, the request is let through.
+func AcquireConcurrency(ctx context.Context, l *concurrency.Limiter, key string, log *logger.Logger) (release func(), err error) {
+	release, err = l.Acquire(ctx, key)
+	if err == nil {
+		return release, nil
+	}
+
+	var reason string
+	switch {
+	case errors.Is(err, concurrency.ErrQueueFull):
+		reason = "queue_full"
+	case errors.Is(err, concurrency.ErrQueueTimeout):
+		reason = "timeout"
+	default:
+		log.Error("Concurrency limiter error", err, map[string]interface{}{"limiter": l.Name()})
+		// Fail open
+		return func() {}, nil
+	}
+
+	metrics.ConcurrencyRejectedTotal.WithLabelValues(l.Name(), reason).Inc()
+	return nil, &RejectError{Status: l.RejectStatus(), Message: "Too many concurrent requests", RetryAfter: "1"}
+}
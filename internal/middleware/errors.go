@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/valyala/fasthttp"
+)
+
+// ErrorJSON writes the gateway's standard JSON error body, tagged with the
+// request ID when one has been assigned.
+func ErrorJSON(c fiber.Ctx, status int, msg string) error {
+	return c.Status(status).JSON(errorBody(c, msg))
+}
+
+func errorBody(c fiber.Ctx, msg string) fiber.Map {
+	body := fiber.Map{"error": msg}
+	if id := GetRequestID(c); id != "" {
+		body["request_id"] = id
+	}
+	return body
+}
+
+// RejectError turns a request away where there is no fiber context to
+// answer with, e.g. in an upstream fetch function. ErrorHandler renders it.
+type RejectError struct {
+	Status     int
+	Message    string
+	RetryAfter string // Sent as Retry-After if set
+}
+
+func (e *RejectError) Error() string {
+	return e.Message
+}
+
+// Write answers c with the rejection.
+func (e *RejectError) Write(c fiber.Ctx) error {
+	if e.RetryAfter != "" {
+		c.Set(fiber.HeaderRetryAfter, e.RetryAfter)
+	}
+	return ErrorJSON(c, e.Status, e.Message)
+}
+
+// ErrorHandler renders errors returned by handlers with ErrorJSON. Upstream
+// timeouts map to 504 and other upstream connection failures to 502; internal
+// error details (e.g. upstream dial errors) are not exposed to clients.
+func ErrorHandler(c fiber.Ctx, err error) error {
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return ErrorJSON(c, fe.Code, fe.Message)
+	}
+	var re *RejectError
+	if errors.As(err, &re) {
+		return re.Write(c)
+	}
+	switch {
+	case upstreamTimeout(err):
+		return ErrorJSON(c, fiber.StatusGatewayTimeout, "Gateway Timeout")
+	case upstreamUnreachable(err):
+		return ErrorJSON(c, fiber.StatusBadGateway, "Bad Gateway")
+	}
+	return ErrorJSON(c, fiber.StatusInternalServerError, "Internal Server Error")
+}
+
+func upstreamTimeout(err error) bool {
+	if errors.Is(err, fasthttp.ErrTimeout) || errors.Is(err, fasthttp.ErrDialTimeout) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+func upstreamUnreachable(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) ||
+		errors.Is(err, fasthttp.ErrConnectionClosed) ||
+		errors.Is(err, fasthttp.ErrNoFreeConns) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
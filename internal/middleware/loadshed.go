@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"vibeway/internal/config"
+	"vibeway/internal/metrics"
+	"vibeway/internal/transform"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Criticality classes, from most to least important.
+const (
+	ClassCritical = "critical"
+	ClassNormal   = "normal"
+	ClassLow      = "low"
+)
+
+var classRank = map[string]int{ClassCritical: 0, ClassNormal: 1, ClassLow: 2}
+
+// ValidClass reports whether class is a criticality class.
+func ValidClass(class string) bool {
+	_, ok := classRank[class]
+	return ok
+}
+
+// LoadShedder decides the criticality class of requests and sheds the lower
+// classes first: each class may only use the share of a capacity that is
+// not reserved for the classes above it.
+type LoadShedder struct {
+	jwt         config.JWTConfig
+	claim       string
+	header      string
+	retryAfter  string
+	maxInflight int64
+	shares      map[string]float64
+
+	inflight atomic.Int64
+}
+
+func NewLoadShedder(cfg config.LoadSheddingConfig, jwtCfg config.JWTConfig) (*LoadShedder, error) {
+	s := &LoadShedder{
+		jwt:         jwtCfg,
+		claim:       cfg.Claim,
+		header:      cfg.Header,
+		retryAfter:  strconv.Itoa(max(cfg.RetryAfterSeconds, 1)),
+		maxInflight: int64(cfg.MaxInflight),
+		shares:      map[string]float64{ClassCritical: 1},
+	}
+
+	for class, share := range cfg.Reserved {
+		if !ValidClass(class) || class == ClassLow {
+			return nil, fmt.Errorf("capacity can be reserved for critical or normal, got %q", class)
+		}
+		if share < 0 {
+			return nil, fmt.Errorf("reserved share of %s must not be negative", class)
+		}
+	}
+	s.shares[ClassNormal] = 1 - cfg.Reserved[ClassCritical]
+	s.shares[ClassLow] = s.shares[ClassNormal] - cfg.Reserved[ClassNormal]
+	if s.shares[ClassLow] < 0.001 {
+		return nil, fmt.Errorf("reserved shares must leave room for low traffic, got %v", cfg.Reserved)
+	}
+	return s, nil
+}
+
+// Class resolves the criticality class of a request: the consumer's claim
+// overrides the route's class, and the header can lower it. Claims come
+// from the JWT middleware or the request's cached bearer token.
+func (s *LoadShedder) Class(c fiber.Ctx, routeClass string) string {
+	if class, ok := c.Locals("criticality").(string); ok {
+		return class
+	}
+
+	class := routeClass
+	if class == "" {
+		class = ClassNormal
+	}
+	if s.claim != "" {
+		if claims, ok := bearerClaims(c, s.jwt); ok {
+			if v := strings.ToLower(transform.ClaimString(claims[s.claim])); ValidClass(v) {
+				class = v
+			}
+		}
+	}
+	if s.header != "" {
+		if v := strings.ToLower(c.Get(s.header)); ValidClass(v) && classRank[v] > classRank[class] {
+			class = v
+		}
+	}
+
+	c.Locals("criticality", class)
+	return class
+}
+
+// Share returns the share of a capacity class may use.
+func (s *LoadShedder) Share(class string) float64 {
+	return s.shares[class]
+}
+
+// Reject writes the 503 for a request shed in scope, e.g. "gateway".
+func (s *LoadShedder) Reject(c fiber.Ctx, scope, class string) error {
+	return s.Rejection(scope, class).Write(c)
+}
+
+// Rejection counts a request shed in scope, e.g. "upstream:orders", and
+// returns its 503 for callers without a fiber context.
+func (s *LoadShedder) Rejection(scope, class string) *RejectError {
+	metrics.LoadShedTotal.WithLabelValues(scope, class).Inc()
+	return &RejectError{Status: fiber.StatusServiceUnavailable, Message: "Service overloaded, please retry", RetryAfter: s.retryAfter}
+}
+
+// Handler caps the gateway's in-flight requests across all routes, if a
+// maximum is configured.
+func (s *LoadShedder) Handler(routeClass string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		class := s.Class(c, routeClass)
+		allowed := max(1, int64(float64(s.maxInflight)*s.Share(class)))
+
+		if s.inflight.Add(1) > allowed {
+			s.inflight.Add(-1)
+			return s.Reject(c, "gateway", class)
+		}
+		defer s.inflight.Add(-1)
+		return c.Next()
+	}
+}
+
+// Enabled reports whether gateway-wide shedding is configured.
+func (s *LoadShedder) Enabled() bool {
+	return s.maxInflight > 0
+}
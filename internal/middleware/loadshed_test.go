@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"math"
+	"testing"
+
+	"vibeway/internal/config"
+)
+
+func TestNewLoadShedderShares(t *testing.T) {
+	tests := []struct {
+		name     string
+		reserved map[string]float64
+		want     map[string]float64
+		wantErr  bool
+	}{
+		{
+			name: "nothing reserved",
+			want: map[string]float64{ClassCritical: 1, ClassNormal: 1, ClassLow: 1},
+		},
+		{
+			name:     "critical and normal reserved",
+			reserved: map[string]float64{ClassCritical: 0.2, ClassNormal: 0.3},
+			want:     map[string]float64{ClassCritical: 1, ClassNormal: 0.8, ClassLow: 0.5},
+		},
+		{
+			name:     "only normal reserved",
+			reserved: map[string]float64{ClassNormal: 0.4},
+			want:     map[string]float64{ClassCritical: 1, ClassNormal: 1, ClassLow: 0.6},
+		},
+		{
+			name:     "low cannot reserve",
+			reserved: map[string]float64{ClassLow: 0.1},
+			wantErr:  true,
+		},
+		{
+			name:     "unknown class",
+			reserved: map[string]float64{"batch": 0.1},
+			wantErr:  true,
+		},
+		{
+			name:     "negative share",
+			reserved: map[string]float64{ClassCritical: -0.1},
+			wantErr:  true,
+		},
+		{
+			name:     "nothing left for low",
+			reserved: map[string]float64{ClassCritical: 0.5, ClassNormal: 0.5},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewLoadShedder(config.LoadSheddingConfig{MaxInflight: 100, Reserved: tt.reserved}, config.JWTConfig{})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("NewLoadShedder succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewLoadShedder: %v", err)
+			}
+			for class, want := range tt.want {
+				if got := s.Share(class); math.Abs(got-want) > 1e-9 {
+					t.Errorf("Share(%s) = %v, want %v", class, got, want)
+				}
+			}
+		})
+	}
+}
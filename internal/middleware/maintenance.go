@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"vibeway/internal/config"
+	"vibeway/pkg/logger"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+const (
+	defaultMaintenanceMessage = "Service is under maintenance"
+	defaultBypassHeader       = "X-Maintenance-Bypass"
+)
+
+// Maintenance answers requests with 503 while a global, route or upstream
+// maintenance window is open, except for requests on the bypass list. It can
+// be switched on and off at runtime.
+type Maintenance struct {
+	scope    string
+	cfg      config.MaintenanceConfig
+	jwt      config.JWTConfig
+	prefixes []netip.Prefix
+	enabled  atomic.Bool
+}
+
+// NewMaintenance builds the switch for scope (e.g. "global", "route:users").
+// Fields left unset in cfg are taken from defaults, the global block.
+func NewMaintenance(scope string, cfg, defaults config.MaintenanceConfig, jwtCfg config.JWTConfig) (*Maintenance, error) {
+	if cfg.RetryAfterSeconds == 0 {
+		cfg.RetryAfterSeconds = defaults.RetryAfterSeconds
+	}
+	if cfg.Message == "" && cfg.Body == "" {
+		cfg.Message, cfg.Body, cfg.ContentType = defaults.Message, defaults.Body, defaults.ContentType
+	}
+	if cfg.Message == "" {
+		cfg.Message = defaultMaintenanceMessage
+	}
+	if cfg.ContentType == "" {
+		cfg.ContentType = fiber.MIMEApplicationJSON
+	}
+
+	bypass := &cfg.Bypass
+	if len(bypass.CIDRs) == 0 {
+		bypass.CIDRs = defaults.Bypass.CIDRs
+	}
+	if bypass.HeaderValue == "" {
+		bypass.Header, bypass.HeaderValue = defaults.Bypass.Header, defaults.Bypass.HeaderValue
+	}
+	if bypass.Header == "" {
+		bypass.Header = defaultBypassHeader
+	}
+	if len(bypass.Roles) == 0 {
+		bypass.Roles = defaults.Bypass.Roles
+	}
+
+	m := &Maintenance{scope: scope, cfg: cfg, jwt: jwtCfg}
+	for _, cidr := range bypass.CIDRs {
+		prefix, err := parsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		m.prefixes = append(m.prefixes, prefix)
+	}
+	m.enabled.Store(cfg.Enabled)
+	return m, nil
+}
+
+// parsePrefix accepts a CIDR or a single address.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid bypass address %q: %w", s, err)
+		}
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid bypass CIDR %q: %w", s, err)
+	}
+	return prefix.Masked(), nil
+}
+
+func (m *Maintenance) Enabled() bool {
+	return m.enabled.Load()
+}
+
+func (m *Maintenance) SetEnabled(enabled bool) {
+	m.enabled.Store(enabled)
+	logger.Warn("Maintenance mode toggled", map[string]interface{}{"scope": m.scope, "enabled": enabled})
+}
+
+// Config returns the effective maintenance configuration, without the bypass
+// secret.
+func (m *Maintenance) Config() config.MaintenanceConfig {
+	cfg := m.cfg
+	cfg.Enabled = m.Enabled()
+	if cfg.Bypass.HeaderValue != "" {
+		cfg.Bypass.HeaderValue = "***"
+	}
+	return cfg
+}
+
+// Active reports whether the request must be turned away.
+func (m *Maintenance) Active(c fiber.Ctx) bool {
+	return m.enabled.Load() && !m.bypassed(c)
+}
+
+// Reject writes the maintenance response.
+func (m *Maintenance) Reject(c fiber.Ctx) error {
+	if m.cfg.RetryAfterSeconds > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(m.cfg.RetryAfterSeconds))
+	}
+	if m.cfg.Body == "" {
+		return ErrorJSON(c, fiber.StatusServiceUnavailable, m.cfg.Message)
+	}
+	c.Set(fiber.HeaderContentType, m.cfg.ContentType)
+	return c.Status(fiber.StatusServiceUnavailable).SendString(m.cfg.Body)
+}
+
+func (m *Maintenance) Handler() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if m.Active(c) {
+			return m.Reject(c)
+		}
+		return c.Next()
+	}
+}
+
+func (m *Maintenance) bypassed(c fiber.Ctx) bool {
+	if len(m.prefixes) > 0 {
+		if addr, err := netip.ParseAddr(c.IP()); err == nil {
+			addr = addr.Unmap()
+			for _, prefix := range m.prefixes {
+				if prefix.Contains(addr) {
+					return true
+				}
+			}
+		}
+	}
+
+	if secret := m.cfg.Bypass.HeaderValue; secret != "" {
+		if subtle.ConstantTimeCompare([]byte(c.Get(m.cfg.Bypass.Header)), []byte(secret)) == 1 {
+			return true
+		}
+	}
+
+	if len(m.cfg.Bypass.Roles) > 0 {
+		if claims, ok := bearerClaims(c, m.jwt); ok && hasAnyRole(claims, m.cfg.Bypass.Roles) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"vibeway/internal/config"
+	"vibeway/internal/metrics"
+	"vibeway/internal/quota"
+	"vibeway/internal/ratelimit"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Quota counts requests against the consumer quotas. It runs in each
+// route's chain after auth and the rate and concurrency limits, so only
+// requests they let through are counted. Responses carry the X-Quota-*
+// headers of the quota with the fewest requests left; exhausted quotas
+// answer 429 until the period resets.
+func Quota(manager *quota.Manager, jwtCfg config.JWTConfig) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if unlimitedPaths[c.Path()] {
+			return c.Next()
+		}
+
+		claims, _ := bearerClaims(c, jwtCfg)
+		value := dimensionValues(c, "", claims)
+
+		var reqs []quota.Request
+		for _, p := range manager.Policies() {
+			if consumer := value(p.Dimension()); consumer != missingDimension {
+				reqs = append(reqs, quota.Request{Policy: p, Consumer: consumer})
+			}
+		}
+		if len(reqs) == 0 {
+			return c.Next()
+		}
+
+		now := time.Now()
+		allowed, usages, err := manager.Consume(c.Context(), now, reqs...)
+		if err != nil {
+			if !errors.Is(err, quota.ErrUnavailable) {
+				Log(c).Error("Quota redis error", err, nil)
+			}
+			// Fail open
+			return c.Next()
+		}
+
+		tightest := usages[0]
+		for _, u := range usages[1:] {
+			if u.Remaining < tightest.Remaining {
+				tightest = u
+			}
+		}
+		setQuotaHeaders(c, tightest, now)
+
+		if !allowed {
+			metrics.QuotaExceededTotal.WithLabelValues(tightest.Quota).Inc()
+			c.Set(fiber.HeaderRetryAfter, ratelimit.Seconds(tightest.ResetsAt.Sub(now)))
+
+			body := errorBody(c, "Quota exceeded")
+			body["quota"] = tightest.Quota
+			return c.Status(fiber.StatusTooManyRequests).JSON(body)
+		}
+
+		// Set again after proxying, the upstream response replaces all headers
+		err = c.Next()
+		setQuotaHeaders(c, tightest, now)
+		return err
+	}
+}
+
+func setQuotaHeaders(c fiber.Ctx, u quota.Usage, now time.Time) {
+	c.Set("X-Quota-Limit", strconv.FormatInt(u.Allowance(), 10))
+	c.Set("X-Quota-Remaining", strconv.FormatInt(u.Remaining, 10))
+	c.Set("X-Quota-Reset", ratelimit.Seconds(u.ResetsAt.Sub(now)))
+}
@@ -1,70 +1,210 @@
 package middleware
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"time"
+	"strconv"
+	"strings"
 
-	"vibeway/pkg/cache"
-	"vibeway/pkg/logger"
+	"vibeway/internal/config"
+	"vibeway/internal/metrics"
+	"vibeway/internal/ratelimit"
+	"vibeway/internal/transform"
 
 	"github.com/gofiber/fiber/v3"
-	"github.com/redis/go-redis/v9"
+	"github.com/golang-jwt/jwt/v5"
 )
 
-// Lua script for atomic rate limiting
-// KEYS[1]: rate limit key
-// ARGV[1]: limit count
-// ARGV[2]: window in seconds
-var rateLimitScript = redis.NewScript(`
-	local key = KEYS[1]
-	local limit = tonumber(ARGV[1])
-	local window = tonumber(ARGV[2])
-
-	local current = redis.call("GET", key)
-	if current and tonumber(current) >= limit then
-		return -1
-	end
-
-	current = redis.call("INCR", key)
-	if tonumber(current) == 1 then
-		redis.call("EXPIRE", key, window)
-	end
-
-	return current
-`)
-
-func RateLimit(limit int, window time.Duration) fiber.Handler {
+const apiKeyHeader = "X-API-Key"
+
+// Larger GraphQL documents are not inspected for their cost
+const maxGraphQLBytes = 1 << 20
+
+// missingDimension stands in for key dimensions the request does not carry,
+// e.g. "sub" on anonymous requests; such requests share one counter.
+const missingDimension = "-"
+
+// unlimitedPaths are gateway endpoints the gateway-wide tiers never count.
+var unlimitedPaths = map[string]bool{
+	"/health":  true,
+	"/metrics": true,
+}
+
+// GatewayRateLimit enforces the global, per-IP and per-consumer tiers before
+// route matching. Consumers are identified by a valid bearer token's subject
+// or the API key; anonymous requests skip the consumer tier. With plans, the
+// consumer's plan replaces the per-consumer limit.
+func GatewayRateLimit(limiter *ratelimit.Limiter, limits []ratelimit.Limit, plans *ratelimit.Plans, jwtCfg config.JWTConfig) fiber.Handler {
 	return func(c fiber.Ctx) error {
-		ip := c.IP()
-		key := fmt.Sprintf("ratelimit:%s", ip)
-
-		// Execute Lua script
-		// Window must be in seconds for EXPIRE
-		windowSeconds := int(window.Seconds())
-		if windowSeconds < 1 {
-			windowSeconds = 1
+		if unlimitedPaths[c.Path()] {
+			return c.Next()
 		}
 
-		result, err := rateLimitScript.Run(c.Context(), cache.Client, []string{key}, limit, windowSeconds).Result()
-		if err != nil {
-			logger.Error("Rate limit redis error", err, nil)
-			// Fail open
-			return c.Next()
+		claims, _ := bearerClaims(c, jwtCfg)
+		value := dimensionValues(c, "", claims)
+
+		applicable := limits
+		consumer := value(ratelimit.DimConsumer)
+		var planLimits []ratelimit.Limit
+		hasPlan := false
+		if consumer != missingDimension && plans != nil {
+			_, planLimits, hasPlan = plans.Resolve(c.Context(), consumer)
+		}
+		if consumer == missingDimension || hasPlan {
+			applicable = make([]ratelimit.Limit, 0, len(limits)+len(planLimits))
+			for _, limit := range limits {
+				if limit.Tier != ratelimit.TierConsumer {
+					applicable = append(applicable, limit)
+				}
+			}
+			applicable = append(applicable, planLimits...)
 		}
+		// Not matched to a route yet
+		return enforceLimits(c, "*", limiter, applicable, value, 0)
+	}
+}
 
-		// Result is the current count, or -1 if exceeded
-		current := result.(int64)
+// RateLimit enforces all limits of a route in one Redis round trip. The sub,
+// claim:<name> and consumer key dimensions need the jwt middleware earlier in
+// the chain. Responses carry the RateLimit and RateLimit-Policy headers, and
+// rejected requests Retry-After and the tier that rejected them. With a
+// coster, requests take their cost in tokens, reported in X-RateLimit-Cost.
+func RateLimit(route string, limiter *ratelimit.Limiter, limits []ratelimit.Limit, coster *ratelimit.Coster) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		claims, _ := c.Locals("claims").(jwt.MapClaims)
 
-		if current == -1 {
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error": "Rate limit exceeded",
+		var cost int
+		if coster != nil {
+			cost = coster.Cost(ratelimit.CostRequest{
+				Method:       c.Method(),
+				Query:        func(name string) string { return c.Query(name) },
+				GraphQLQuery: func() string { return graphQLQuery(c) },
 			})
 		}
+		return enforceLimits(c, route, limiter, limits, dimensionValues(c, route, claims), cost)
+	}
+}
 
-		// Optional: Add headers
-		c.Response().Header.Set("X-RateLimit-Limit", fmt.Sprintf("%d", limit))
-		c.Response().Header.Set("X-RateLimit-Remaining", fmt.Sprintf("%d", int64(limit)-current))
-
+// enforceLimits checks limits at cost tokens; a cost of 0 counts one request
+// without reporting a cost.
+func enforceLimits(c fiber.Ctx, route string, limiter *ratelimit.Limiter, limits []ratelimit.Limit, value func(dim string) string, cost int) error {
+	if len(limits) == 0 {
 		return c.Next()
 	}
+
+	reqs := make([]ratelimit.Request, 0, len(limits))
+	for _, limit := range limits {
+		reqs = append(reqs, ratelimit.Request{Key: limit.RedisKey(value), Limit: limit, Cost: cost})
+	}
+	if cost > 0 {
+		c.Set("X-RateLimit-Cost", strconv.Itoa(cost))
+	}
+
+	decision, err := limiter.Allow(c.Context(), reqs...)
+	if err != nil {
+		// Only fail_closed reports an error
+		return ErrorJSON(c, fiber.StatusServiceUnavailable, "Rate limiter unavailable")
+	}
+
+	setRateLimitHeaders(c, decision)
+
+	if !decision.Allowed {
+		rejected := decision.Tightest()
+		metrics.RateLimitHitsTotal.WithLabelValues(route, c.IP(), rejected.Limit.Tier).Inc()
+		c.Set(fiber.HeaderRetryAfter, ratelimit.Seconds(rejected.RetryAfter))
+
+		body := errorBody(c, "Rate limit exceeded")
+		body["tier"] = rejected.Limit.Tier
+		body["limit"] = rejected.Limit.Name
+		return c.Status(fiber.StatusTooManyRequests).JSON(body)
+	}
+
+	if cost > 0 {
+		metrics.RateLimitCostTotal.WithLabelValues(route, value(ratelimit.DimConsumer)).Add(float64(cost))
+	}
+
+	// Set again after proxying, the upstream response replaces all headers
+	err = c.Next()
+	setRateLimitHeaders(c, decision)
+	if cost > 0 {
+		c.Set("X-RateLimit-Cost", strconv.Itoa(cost))
+	}
+	return err
+}
+
+// graphQLQuery returns the query of a GraphQL request sent as a query
+// parameter, a JSON body or an application/graphql body.
+func graphQLQuery(c fiber.Ctx) string {
+	if q := c.Query("query"); q != "" {
+		return q
+	}
+	if c.Method() != fiber.MethodPost || len(c.Body()) > maxGraphQLBytes {
+		return ""
+	}
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), "application/graphql") {
+		return string(c.Body())
+	}
+	var body struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return ""
+	}
+	return body.Query
+}
+
+// dimensionValues resolves rate limit key dimensions for the request.
+func dimensionValues(c fiber.Ctx, route string, claims jwt.MapClaims) func(dim string) string {
+	var value func(dim string) string
+	value = func(dim string) string {
+		var v string
+		switch dim {
+		case ratelimit.DimRoute:
+			v = route
+		case ratelimit.DimIP:
+			v = c.IP()
+		case ratelimit.DimMethod:
+			v = c.Method()
+		case ratelimit.DimSubject:
+			v = transform.ClaimString(claims["sub"])
+		case ratelimit.DimAPIKey:
+			// Keep API keys out of Redis key names
+			if key := c.Get(apiKeyHeader); key != "" {
+				sum := sha256.Sum256([]byte(key))
+				v = hex.EncodeToString(sum[:8])
+			}
+		case ratelimit.DimConsumer:
+			if v = value(ratelimit.DimSubject); v == missingDimension {
+				v = value(ratelimit.DimAPIKey)
+			}
+		default:
+			if name, ok := strings.CutPrefix(dim, ratelimit.DimClaimPrefix); ok {
+				v = transform.ClaimString(claims[name])
+			} else if name, ok := strings.CutPrefix(dim, ratelimit.DimHeaderPrefix); ok {
+				v = c.Get(name)
+			}
+		}
+		if v == "" {
+			return missingDimension
+		}
+		return v
+	}
+	return value
+}
+
+func setRateLimitHeaders(c fiber.Ctx, d ratelimit.Decision) {
+	// Failing open leaves nothing to report
+	if len(d.Results) == 0 {
+		return
+	}
+
+	r := d.Tightest()
+	c.Set("RateLimit-Policy", d.Policies())
+	c.Set("RateLimit", fmt.Sprintf("%q;r=%d;t=%s", r.Limit.Name, r.Remaining, ratelimit.Seconds(r.Reset)))
+
+	// Legacy headers
+	c.Set("X-RateLimit-Limit", fmt.Sprintf("%d", r.Limit.Limit))
+	c.Set("X-RateLimit-Remaining", fmt.Sprintf("%d", r.Remaining))
 }
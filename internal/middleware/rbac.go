@@ -14,29 +14,39 @@ func RBAC(requiredRoles []string) fiber.Handler {
 
 		claims, ok := c.Locals("claims").(jwt.MapClaims)
 		if !ok {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "No user claims found"})
+			return ErrorJSON(c, fiber.StatusForbidden, "No user claims found")
 		}
 
-		userRolesInterface, ok := claims["roles"].([]interface{})
-		if !ok {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "User has no roles"})
+		if _, ok := claims["roles"].([]interface{}); !ok {
+			return ErrorJSON(c, fiber.StatusForbidden, "User has no roles")
 		}
 
-		userRoles := make(map[string]bool)
-		for _, r := range userRolesInterface {
-			if roleStr, ok := r.(string); ok {
-				userRoles[roleStr] = true
-			}
+		if hasAnyRole(claims, requiredRoles) {
+			return c.Next()
 		}
 
-		for _, required := range requiredRoles {
-			if userRoles[required] {
-				return c.Next()
-			}
+		return ErrorJSON(c, fiber.StatusForbidden, "Insufficient permissions")
+	}
+}
+
+// hasAnyRole reports whether the "roles" claim contains one of roles.
+func hasAnyRole(claims jwt.MapClaims, roles []string) bool {
+	userRolesInterface, ok := claims["roles"].([]interface{})
+	if !ok {
+		return false
+	}
+
+	userRoles := make(map[string]bool)
+	for _, r := range userRolesInterface {
+		if roleStr, ok := r.(string); ok {
+			userRoles[roleStr] = true
 		}
+	}
 
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "Insufficient permissions",
-		})
+	for _, required := range roles {
+		if userRoles[required] {
+			return true
+		}
 	}
+	return false
 }
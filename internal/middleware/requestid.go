@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"regexp"
+	"strings"
+	"time"
+
+	"vibeway/internal/config"
+	"vibeway/pkg/logger"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultRequestIDHeader  = "X-Request-Id"
+	defaultRequestIDPattern = `^[A-Za-z0-9._:\-]{8,128}$`
+
+	requestIDLocal = "request_id"
+	loggerLocal    = "logger"
+)
+
+// RequestID accepts a well-formed incoming request ID or generates a new one,
+// forwards it upstream, echoes it to the client and exposes it to the rest of
+// the chain through GetRequestID.
+func RequestID(cfg config.RequestIDConfig) fiber.Handler {
+	header := RequestIDHeader(cfg)
+
+	pattern := regexp.MustCompile(defaultRequestIDPattern)
+	if cfg.Pattern != "" {
+		p, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			logger.Error("Invalid request ID pattern, using default", err, map[string]interface{}{"pattern": cfg.Pattern})
+		} else {
+			pattern = p
+		}
+	}
+
+	generate := newUUIDv7
+	if cfg.Generator == "ulid" {
+		generate = newULID
+	}
+
+	return func(c fiber.Ctx) error {
+		// Clone: the ID outlives the request buffers in logs and background work
+		id := strings.Clone(c.Get(header))
+		if id == "" || !pattern.MatchString(id) {
+			id = generate()
+		}
+
+		c.Locals(requestIDLocal, id)
+		c.Locals(loggerLocal, logger.With(map[string]interface{}{"request_id": id}))
+		c.Request().Header.Set(header, id)
+		c.Set(header, id)
+
+		trace.SpanFromContext(c.Context()).SetAttributes(attribute.String("request.id", id))
+
+		err := c.Next()
+
+		// Proxying replaces the whole response, so echo the ID again afterwards
+		c.Set(header, id)
+		return err
+	}
+}
+
+// RequestIDHeader returns the configured request ID header name.
+func RequestIDHeader(cfg config.RequestIDConfig) string {
+	if cfg.Header != "" {
+		return cfg.Header
+	}
+	return defaultRequestIDHeader
+}
+
+// GetRequestID returns the ID assigned by RequestID, or "" if it did not run.
+func GetRequestID(c fiber.Ctx) string {
+	id, _ := c.Locals(requestIDLocal).(string)
+	return id
+}
+
+// Log returns the request's logger, which tags every entry with the request
+// ID assigned by RequestID.
+func Log(c fiber.Ctx) *logger.Logger {
+	if l, ok := c.Locals(loggerLocal).(*logger.Logger); ok {
+		return l
+	}
+	return logger.With(nil)
+}
+
+func newUUIDv7() string {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return uuid.NewString()
+	}
+	return id.String()
+}
+
+// crockford is the ULID base32 alphabet.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a 26 character ULID: a 48-bit millisecond timestamp
+// followed by 80 random bits, Crockford base32 encoded.
+func newULID() string {
+	var raw [16]byte
+	binary.BigEndian.PutUint64(raw[:8], uint64(time.Now().UnixMilli())<<16)
+	_, _ = rand.Read(raw[6:])
+
+	// Encode 128 bits as 26 characters, 5 bits at a time, most significant first
+	var out [26]byte
+	hi := binary.BigEndian.Uint64(raw[:8])
+	lo := binary.BigEndian.Uint64(raw[8:])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
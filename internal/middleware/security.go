@@ -32,9 +32,7 @@ func Security() fiber.Handler {
 		// In a real WAF, this would be much more robust
 		path := c.Path()
 		if containsSuspiciousPatterns(path) {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Malicious input detected",
-			})
+			return ErrorJSON(c, fiber.StatusBadRequest, "Malicious input detected")
 		}
 
 		return c.Next()
@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"vibeway/internal/config"
+	"vibeway/internal/metrics"
+	"vibeway/internal/transform"
+	"vibeway/pkg/logger"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	defaultMirrorMaxConcurrent = 100
+	defaultMirrorTimeout       = time.Second
+
+	// mirrorMaxResponseBytes bounds how much of a mirror response is read
+	// and discarded. Reading it keeps pooled keep-alive connections usable;
+	// larger bodies fail the read and the connection is closed.
+	mirrorMaxResponseBytes = 64 << 10
+)
+
+// Mirror shadows a sample of route traffic to a secondary upstream. Copies
+// are sent asynchronously with their own concurrency limit and timeout, so
+// they never add latency to the primary request.
+type Mirror struct {
+	route    string
+	cfg      config.MirrorConfig
+	client   *fasthttp.Client
+	timeout  time.Duration
+	slots    chan struct{}
+	redactor *transform.BodyRules
+}
+
+// NewMirror returns nil if the route has no mirror configured.
+func NewMirror(route string, cfg config.MirrorConfig) (*Mirror, error) {
+	if cfg.Upstream == "" || cfg.Percentage <= 0 {
+		return nil, nil
+	}
+
+	maxConcurrent := cfg.MaxConcurrent
+	if maxConcurrent <= 0 {
+		maxConcurrent = defaultMirrorMaxConcurrent
+	}
+	timeout := time.Duration(cfg.TimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = defaultMirrorTimeout
+	}
+
+	m := &Mirror{
+		route: route,
+		cfg:   cfg,
+		client: &fasthttp.Client{
+			ReadTimeout:         timeout,
+			WriteTimeout:        timeout,
+			MaxResponseBodySize: mirrorMaxResponseBytes,
+		},
+		timeout: timeout,
+		slots:   make(chan struct{}, maxConcurrent),
+	}
+
+	if len(cfg.RedactBodyPaths) > 0 {
+		ops := make([]config.BodyOperationConfig, 0, len(cfg.RedactBodyPaths))
+		for _, path := range cfg.RedactBodyPaths {
+			ops = append(ops, config.BodyOperationConfig{Op: "remove", Path: path})
+		}
+		redactor, err := transform.NewBodyRules(config.BodyTransformConfig{Operations: ops})
+		if err != nil {
+			return nil, err
+		}
+		m.redactor = redactor
+	}
+
+	return m, nil
+}
+
+// Upstream returns the name of the mirror upstream.
+func (m *Mirror) Upstream() string {
+	return m.cfg.Upstream
+}
+
+// Sample decides whether the current request should be mirrored.
+func (m *Mirror) Sample() bool {
+	return m.cfg.Percentage >= 100 || rand.Float64()*100 < m.cfg.Percentage
+}
+
+// Send copies req and sends it to mirrorURL in the background. When all
+// mirror slots are busy the copy is dropped instead of queued.
+func (m *Mirror) Send(req *fasthttp.Request, mirrorURL string) {
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		metrics.MirrorRequestsTotal.WithLabelValues(m.route, m.cfg.Upstream, "dropped").Inc()
+		return
+	}
+
+	// Only the copy happens on the primary request's goroutine; req is
+	// reused once the primary request completes
+	mreq := fasthttp.AcquireRequest()
+	req.CopyTo(mreq)
+
+	go func() {
+		defer func() { <-m.slots }()
+		defer fasthttp.ReleaseRequest(mreq)
+
+		mreq.SetRequestURI(mirrorURL)
+		stripHopByHop(connectionTokens(mreq.Header.Peek("Connection")), mreq.Header.Del)
+		m.redact(mreq)
+
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseResponse(resp)
+
+		result := "error"
+		err := m.client.DoTimeout(mreq, resp, m.timeout)
+		if err == fasthttp.ErrBodyTooLarge {
+			// The status line was read, only the discarded body was too big
+			err = nil
+		}
+		if err != nil {
+			if err == fasthttp.ErrTimeout {
+				result = "timeout"
+			}
+			logger.Debug("Mirror request failed", map[string]interface{}{
+				"route":    m.route,
+				"upstream": m.cfg.Upstream,
+				"error":    err.Error(),
+			})
+		} else {
+			result = strconv.Itoa(resp.StatusCode()/100) + "xx"
+		}
+		metrics.MirrorRequestsTotal.WithLabelValues(m.route, m.cfg.Upstream, result).Inc()
+	}()
+}
+
+func (m *Mirror) redact(req *fasthttp.Request) {
+	for _, h := range m.cfg.RedactHeaders {
+		req.Header.Del(h)
+	}
+
+	if m.cfg.DropBody {
+		req.ResetBody()
+		return
+	}
+
+	if m.redactor != nil {
+		if body, ok := m.redactor.Transform(req.Body(), string(req.Header.ContentType()), string(req.Header.ContentEncoding())); ok {
+			req.SetBody(body)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package proxy
 
 import (
+	"bytes"
+	"strings"
 	"time"
 
 	"vibeway/pkg/logger"
@@ -8,28 +10,56 @@ import (
 	"github.com/valyala/fasthttp"
 )
 
+// hopByHopHeaders are the RFC 7230 section 6.1 connection-scoped headers that
+// must not be forwarded by a proxy in either direction.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"TE",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
 type ProxyClient struct {
-	client *fasthttp.Client
+	client          *fasthttp.Client
+	requestIDHeader string
 }
 
-func NewProxyClient(readTimeout, writeTimeout time.Duration) *ProxyClient {
+// NewProxyClient creates a client that tags its log lines with the request ID
+// found in requestIDHeader.
+func NewProxyClient(readTimeout, writeTimeout time.Duration, requestIDHeader string) *ProxyClient {
 	return &ProxyClient{
 		client: &fasthttp.Client{
 			ReadTimeout:  readTimeout,
 			WriteTimeout: writeTimeout,
 		},
+		requestIDHeader: requestIDHeader,
 	}
 }
 
 func (p *ProxyClient) Do(req *fasthttp.Request, resp *fasthttp.Response, upstreamURL string) error {
+	return p.DoTimeout(req, resp, upstreamURL, 0)
+}
+
+// DoTimeout is Do with a deadline for the whole exchange; zero means the
+// client's read and write timeouts only.
+func (p *ProxyClient) DoTimeout(req *fasthttp.Request, resp *fasthttp.Response, upstreamURL string, timeout time.Duration) error {
 	// Prepare request
 	req.SetRequestURI(upstreamURL)
-	req.Header.Del("Connection")
-	req.Header.Del("Keep-Alive")
+	stripHopByHop(connectionTokens(req.Header.Peek("Connection")), req.Header.Del)
 
 	// Execute request
 	start := time.Now()
-	err := p.client.Do(req, resp)
+	var err error
+	if timeout > 0 {
+		err = p.client.DoTimeout(req, resp, timeout)
+	} else {
+		err = p.client.Do(req, resp)
+	}
 	duration := time.Since(start)
 
 	// Log result
@@ -38,12 +68,44 @@ func (p *ProxyClient) Do(req *fasthttp.Request, resp *fasthttp.Response, upstrea
 		"latency":  duration.String(),
 		"status":   resp.StatusCode(),
 	}
+	if id := req.Header.Peek(p.requestIDHeader); len(id) > 0 {
+		fields["request_id"] = string(id)
+	}
 
 	if err != nil {
 		logger.Error("Proxy request failed", err, fields)
 		return err
 	}
 
+	stripHopByHop(connectionTokens(resp.Header.Peek("Connection")), resp.Header.Del)
+
 	logger.Info("Proxy request success", fields)
 	return nil
 }
+
+// connectionTokens returns the extra header names listed in a Connection
+// header, which are hop-by-hop as well.
+func connectionTokens(v []byte) []string {
+	var tokens []string
+	for _, t := range bytes.Split(v, []byte(",")) {
+		t = bytes.TrimSpace(t)
+		if len(t) == 0 {
+			continue
+		}
+		name := string(t)
+		if strings.EqualFold(name, "close") || strings.EqualFold(name, "keep-alive") {
+			continue
+		}
+		tokens = append(tokens, name)
+	}
+	return tokens
+}
+
+func stripHopByHop(extra []string, del func(string)) {
+	for _, h := range extra {
+		del(h)
+	}
+	for _, h := range hopByHopHeaders {
+		del(h)
+	}
+}
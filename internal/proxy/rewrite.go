@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"bytes"
+	"strings"
+
+	"vibeway/internal/config"
+	"vibeway/pkg/logger"
+
+	"github.com/valyala/fasthttp"
+)
+
+var defaultRewriteContentTypes = []string{"text/html", "application/json"}
+
+// Rewriter maps upstream-scoped redirects, cookies and absolute URLs back to
+// the public address and route prefix the client used.
+type Rewriter struct {
+	cfg          config.ResponseRewriteConfig
+	contentTypes []string
+}
+
+func NewRewriter(cfg config.ResponseRewriteConfig) *Rewriter {
+	contentTypes := cfg.BodyContentTypes
+	if len(contentTypes) == 0 {
+		contentTypes = defaultRewriteContentTypes
+	}
+	return &Rewriter{cfg: cfg, contentTypes: contentTypes}
+}
+
+// Enabled reports whether any rewriting is configured.
+func (rw *Rewriter) Enabled() bool {
+	return rw.cfg.Location || rw.cfg.Cookies || rw.cfg.Body
+}
+
+// RewritesBody reports whether response bodies are rewritten. The proxy asks
+// the upstream for an unencoded body in that case.
+func (rw *Rewriter) RewritesBody() bool {
+	return rw.cfg.Body
+}
+
+// Apply rewrites resp in place. upstreamURLs are the base URLs of the
+// upstream, publicBase is the client-facing origin (scheme://host) and prefix
+// is the route prefix that was stripped before proxying.
+func (rw *Rewriter) Apply(resp *fasthttp.Response, upstreamURLs []string, publicBase, prefix string) {
+	if rw.cfg.Location {
+		for _, h := range []string{fasthttp.HeaderLocation, fasthttp.HeaderContentLocation} {
+			if v := resp.Header.Peek(h); len(v) > 0 {
+				resp.Header.Set(h, rewriteURL(string(v), upstreamURLs, publicBase, prefix))
+			}
+		}
+	}
+
+	if rw.cfg.Cookies {
+		rw.rewriteCookies(resp, prefix)
+	}
+
+	if rw.cfg.Body {
+		rw.rewriteBody(resp, upstreamURLs, publicBase+prefix)
+	}
+}
+
+// rewriteURL turns an upstream absolute URL or absolute path into its public
+// equivalent. Anything pointing elsewhere is left untouched.
+func rewriteURL(v string, upstreamURLs []string, publicBase, prefix string) string {
+	for _, u := range upstreamURLs {
+		base := strings.TrimSuffix(u, "/")
+		if v == base || strings.HasPrefix(v, base+"/") || strings.HasPrefix(v, base+"?") {
+			return publicBase + prefix + ensureLeadingSlash(strings.TrimPrefix(v, base))
+		}
+	}
+
+	// Absolute path on the upstream, but not a protocol-relative URL
+	if strings.HasPrefix(v, "/") && !strings.HasPrefix(v, "//") && prefix != "" && !strings.HasPrefix(v, prefix+"/") {
+		return prefix + v
+	}
+
+	return v
+}
+
+func (rw *Rewriter) rewriteCookies(resp *fasthttp.Response, prefix string) {
+	var cookies []*fasthttp.Cookie
+	for _, value := range resp.Header.Cookies() {
+		cookie := fasthttp.AcquireCookie()
+		if err := cookie.ParseBytes(value); err != nil {
+			fasthttp.ReleaseCookie(cookie)
+			continue
+		}
+		cookies = append(cookies, cookie)
+	}
+
+	for _, cookie := range cookies {
+		cookie.SetDomain(rw.cfg.CookieDomain)
+
+		if prefix != "" {
+			path := string(cookie.Path())
+			if path == "" || path == "/" {
+				cookie.SetPath(prefix)
+			} else if !strings.HasPrefix(path, prefix+"/") && path != prefix {
+				cookie.SetPath(prefix + ensureLeadingSlash(path))
+			}
+		}
+
+		resp.Header.SetCookie(cookie)
+		fasthttp.ReleaseCookie(cookie)
+	}
+}
+
+func (rw *Rewriter) rewriteBody(resp *fasthttp.Response, upstreamURLs []string, publicBase string) {
+	contentType := string(resp.Header.ContentType())
+	matched := false
+	for _, ct := range rw.contentTypes {
+		if strings.HasPrefix(contentType, ct) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return
+	}
+
+	body := resp.Body()
+	encoded := len(resp.Header.ContentEncoding()) > 0
+	if encoded {
+		// The upstream encoded the body despite Accept-Encoding: identity
+		decoded, err := resp.BodyUncompressed()
+		if err != nil {
+			logger.Warn("Response body not rewritten, cannot decode it", map[string]interface{}{
+				"encoding": string(resp.Header.ContentEncoding()),
+				"error":    err.Error(),
+			})
+			return
+		}
+		body = decoded
+	}
+
+	changed := false
+	for _, u := range upstreamURLs {
+		base := []byte(strings.TrimSuffix(u, "/"))
+		if bytes.Contains(body, base) {
+			body = bytes.ReplaceAll(body, base, []byte(publicBase))
+			changed = true
+		}
+	}
+
+	// SetBody also refreshes Content-Length
+	if changed {
+		resp.SetBody(body)
+		if encoded {
+			resp.Header.Del(fasthttp.HeaderContentEncoding)
+		}
+	}
+}
+
+func ensureLeadingSlash(p string) string {
+	if p == "" || p[0] != '/' {
+		return "/" + p
+	}
+	return p
+}
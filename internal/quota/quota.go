@@ -0,0 +1,113 @@
+package quota
+
+import (
+	"fmt"
+	"time"
+
+	"vibeway/internal/config"
+	"vibeway/internal/ratelimit"
+)
+
+// Periods a quota resets after, aligned to the calendar of its timezone.
+const (
+	Day   = "day"
+	Month = "month"
+)
+
+// Identities a quota is counted per.
+const (
+	IdentitySubject  = "sub"
+	IdentityClientID = "client_id"
+	IdentityAPIKey   = "api_key"
+	IdentityConsumer = "consumer"
+)
+
+// Policy is a validated quota.
+type Policy struct {
+	Name     string
+	Limit    int64
+	Period   string
+	Location *time.Location
+	Identity string
+}
+
+// NewPolicies validates cfgs and fills in the defaults.
+func NewPolicies(cfgs []config.QuotaConfig) ([]Policy, error) {
+	policies := make([]Policy, 0, len(cfgs))
+	seen := make(map[string]bool, len(cfgs))
+	for i, cfg := range cfgs {
+		p, err := NewPolicy(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("quota %d: %w", i, err)
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("duplicate quota %q", p.Name)
+		}
+		seen[p.Name] = true
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+func NewPolicy(cfg config.QuotaConfig) (Policy, error) {
+	p := Policy{
+		Name:     cfg.Name,
+		Limit:    cfg.Limit,
+		Period:   cfg.Period,
+		Identity: cfg.Identity,
+	}
+	if p.Name == "" {
+		return Policy{}, fmt.Errorf("quota needs a name")
+	}
+	if p.Limit <= 0 {
+		return Policy{}, fmt.Errorf("quota limit must be positive, got %d", p.Limit)
+	}
+	switch p.Period {
+	case Day, Month:
+	default:
+		return Policy{}, fmt.Errorf("quota period must be day or month, got %q", p.Period)
+	}
+
+	loc, err := time.LoadLocation(cfg.Timezone) // "" is UTC
+	if err != nil {
+		return Policy{}, fmt.Errorf("quota timezone: %w", err)
+	}
+	p.Location = loc
+
+	if p.Identity == "" {
+		p.Identity = IdentityConsumer
+	}
+	switch p.Identity {
+	case IdentitySubject, IdentityClientID, IdentityAPIKey, IdentityConsumer:
+	default:
+		return Policy{}, fmt.Errorf("unknown quota identity %q", p.Identity)
+	}
+	return p, nil
+}
+
+// Dimension returns the rate limit key dimension that identifies consumers.
+func (p Policy) Dimension() string {
+	switch p.Identity {
+	case IdentitySubject:
+		return ratelimit.DimSubject
+	case IdentityClientID:
+		return ratelimit.DimClaimPrefix + "client_id"
+	case IdentityAPIKey:
+		return ratelimit.DimAPIKey
+	default:
+		return ratelimit.DimConsumer
+	}
+}
+
+// Window returns the period containing t: an ID such as "2026-10" or
+// "2026-10-19", and when it ends.
+func (p Policy) Window(t time.Time) (id string, end time.Time) {
+	t = t.In(p.Location)
+	y, m, d := t.Date()
+	if p.Period == Month {
+		start := time.Date(y, m, 1, 0, 0, 0, 0, p.Location)
+		return start.Format("2006-01"), start.AddDate(0, 1, 0)
+	}
+	start := time.Date(y, m, d, 0, 0, 0, 0, p.Location)
+	return start.Format("2006-01-02"), start.AddDate(0, 0, 1)
+}
@@ -0,0 +1,207 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"vibeway/internal/upstream"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrUnavailable is returned by Consume while the Redis breaker is open.
+var ErrUnavailable = errors.New("quota store unavailable")
+
+// Counters outlive their period a little so instances with a skewed clock
+// still find them.
+const expirySlack = time.Hour
+
+// consumeScript counts one request against every quota, unless any of them is
+// exhausted. KEYS are usage and top-up key pairs, ARGV limit and expiry
+// (unix seconds) pairs. Returns {allowed, used and allowance per quota}.
+var consumeScript = redis.NewScript(`
+local n = #KEYS / 2
+local used, allowance = {}, {}
+local allowed = 1
+for i = 1, n do
+	used[i] = tonumber(redis.call('GET', KEYS[2*i-1]) or '0')
+	allowance[i] = tonumber(ARGV[2*i-1]) + tonumber(redis.call('GET', KEYS[2*i]) or '0')
+	if used[i] + 1 > allowance[i] then
+		allowed = 0
+	end
+end
+
+local res = {allowed}
+for i = 1, n do
+	if allowed == 1 then
+		used[i] = redis.call('INCR', KEYS[2*i-1])
+		redis.call('EXPIREAT', KEYS[2*i-1], ARGV[2*i])
+	end
+	table.insert(res, used[i])
+	table.insert(res, allowance[i])
+end
+return res
+`)
+
+// Request is one request counted against a quota for a consumer.
+type Request struct {
+	Policy   Policy
+	Consumer string
+}
+
+// Usage is the state of a consumer's quota in the current period.
+type Usage struct {
+	Quota     string    `json:"quota"`
+	Consumer  string    `json:"consumer"`
+	Period    string    `json:"period"`
+	Limit     int64     `json:"limit"`
+	TopUp     int64     `json:"top_up"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+// Allowance is the limit plus top-ups.
+func (u Usage) Allowance() int64 {
+	return u.Limit + u.TopUp
+}
+
+// Manager keeps quota counters in Redis. Counting goes through breaker, so
+// requests do not wait on Redis timeouts while it is down.
+type Manager struct {
+	client   *redis.Client
+	breaker  *upstream.CircuitBreaker
+	policies []Policy
+	byName   map[string]Policy
+}
+
+func NewManager(client *redis.Client, policies []Policy, breaker *upstream.CircuitBreaker) *Manager {
+	m := &Manager{client: client, breaker: breaker, policies: policies, byName: make(map[string]Policy, len(policies))}
+	for _, p := range policies {
+		m.byName[p.Name] = p
+	}
+	return m
+}
+
+func (m *Manager) Policies() []Policy {
+	return m.policies
+}
+
+func (m *Manager) Policy(name string) (Policy, bool) {
+	p, ok := m.byName[name]
+	return p, ok
+}
+
+// Consume counts the request against every quota in one round trip.
+// Nothing is counted unless every quota has room left; the returned usage
+// includes the request if it was counted. It returns ErrUnavailable without
+// a round trip while the breaker is open.
+func (m *Manager) Consume(ctx context.Context, now time.Time, reqs ...Request) (bool, []Usage, error) {
+	if !m.breaker.Allow() {
+		return false, nil, ErrUnavailable
+	}
+
+	keys := make([]string, 0, 2*len(reqs))
+	args := make([]interface{}, 0, 2*len(reqs))
+	usages := make([]Usage, len(reqs))
+	for i, r := range reqs {
+		usages[i] = newUsage(r.Policy, r.Consumer, now)
+		usage, topUp := redisKeys(r.Policy, r.Consumer, usages[i].Period)
+		keys = append(keys, usage, topUp)
+		args = append(args, r.Policy.Limit, usages[i].ResetsAt.Add(expirySlack).Unix())
+	}
+
+	raw, err := consumeScript.Run(ctx, m.client, keys, args...).Int64Slice()
+	if err != nil {
+		m.breaker.RecordFailure()
+		return false, nil, err
+	}
+	m.breaker.RecordSuccess()
+	if len(raw) != 1+2*len(reqs) {
+		return false, nil, fmt.Errorf("unexpected quota script reply of %d values", len(raw))
+	}
+
+	for i := range usages {
+		usages[i].Used = raw[1+2*i]
+		usages[i].TopUp = raw[2+2*i] - usages[i].Limit
+		usages[i].Remaining = max(usages[i].Allowance()-usages[i].Used, 0)
+	}
+	return raw[0] == 1, usages, nil
+}
+
+// Usage reports a consumer's quota in the current period.
+func (m *Manager) Usage(ctx context.Context, p Policy, consumer string, now time.Time) (Usage, error) {
+	u := newUsage(p, consumer, now)
+	usageKey, topUpKey := redisKeys(p, consumer, u.Period)
+
+	values, err := m.client.MGet(ctx, usageKey, topUpKey).Result()
+	if err != nil {
+		return Usage{}, err
+	}
+	if u.Used, err = counter(values[0]); err != nil {
+		return Usage{}, err
+	}
+	if u.TopUp, err = counter(values[1]); err != nil {
+		return Usage{}, err
+	}
+	u.Remaining = max(u.Allowance()-u.Used, 0)
+	return u, nil
+}
+
+// Reset clears a consumer's usage in the current period. Top-ups are kept.
+func (m *Manager) Reset(ctx context.Context, p Policy, consumer string, now time.Time) (Usage, error) {
+	id, _ := p.Window(now)
+	usageKey, _ := redisKeys(p, consumer, id)
+	if err := m.client.Del(ctx, usageKey).Err(); err != nil {
+		return Usage{}, err
+	}
+	return m.Usage(ctx, p, consumer, now)
+}
+
+// TopUp grants a consumer amount extra requests for the current period.
+func (m *Manager) TopUp(ctx context.Context, p Policy, consumer string, amount int64, now time.Time) (Usage, error) {
+	if amount <= 0 {
+		return Usage{}, errors.New("top-up amount must be positive")
+	}
+	id, end := p.Window(now)
+	_, topUpKey := redisKeys(p, consumer, id)
+
+	pipe := m.client.TxPipeline()
+	pipe.IncrBy(ctx, topUpKey, amount)
+	pipe.ExpireAt(ctx, topUpKey, end.Add(expirySlack))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Usage{}, err
+	}
+	return m.Usage(ctx, p, consumer, now)
+}
+
+func newUsage(p Policy, consumer string, now time.Time) Usage {
+	id, end := p.Window(now)
+	return Usage{
+		Quota:     p.Name,
+		Consumer:  consumer,
+		Period:    id,
+		Limit:     p.Limit,
+		Remaining: p.Limit,
+		ResetsAt:  end,
+	}
+}
+
+func redisKeys(p Policy, consumer, period string) (usage, topUp string) {
+	usage = "quota:" + p.Name + ":" + consumer + ":" + period
+	return usage, usage + ":topup"
+}
+
+func counter(v interface{}) (int64, error) {
+	if v == nil {
+		return 0, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected quota counter %v", v)
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
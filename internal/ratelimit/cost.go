@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"vibeway/internal/config"
+)
+
+// Coster works out what a request costs in tokens.
+type Coster struct {
+	base    int
+	methods map[string]int
+	query   string
+	graphQL bool
+	perUnit float64
+	max     int
+}
+
+// CostRequest holds the parts of a request its cost may depend on.
+type CostRequest struct {
+	Method       string
+	Query        func(name string) string
+	GraphQLQuery func() string // Read only if the cost depends on it
+}
+
+// NewCoster returns nil if cfg leaves every request at a cost of one.
+func NewCoster(cfg config.CostConfig) (*Coster, error) {
+	if cfg.Default <= 1 && len(cfg.Methods) == 0 && cfg.Query == "" && !cfg.GraphQL {
+		return nil, nil
+	}
+
+	c := &Coster{
+		base:    max(cfg.Default, 1),
+		methods: make(map[string]int, len(cfg.Methods)),
+		query:   cfg.Query,
+		graphQL: cfg.GraphQL,
+		perUnit: cfg.PerUnit,
+		max:     cfg.Max,
+	}
+	for method, cost := range cfg.Methods {
+		if cost <= 0 {
+			return nil, fmt.Errorf("cost of %s must be positive, got %d", method, cost)
+		}
+		c.methods[strings.ToUpper(method)] = cost
+	}
+	if c.perUnit < 0 {
+		return nil, fmt.Errorf("cost per unit must not be negative, got %v", cfg.PerUnit)
+	}
+	if c.perUnit == 0 {
+		c.perUnit = 1
+	}
+	if c.max < 0 {
+		return nil, fmt.Errorf("maximum cost must not be negative, got %d", cfg.Max)
+	}
+	return c, nil
+}
+
+// Fit checks the maximum cost against the limits the cost is spent from, as
+// a request costing more than a limit's capacity could never pass. Without
+// a maximum, costs are capped at the smallest capacity.
+func (c *Coster) Fit(limits []Limit) error {
+	if len(limits) == 0 {
+		return nil
+	}
+	smallest := limits[0]
+	for _, l := range limits[1:] {
+		if l.Capacity() < smallest.Capacity() {
+			smallest = l
+		}
+	}
+	if c.max > smallest.Capacity() {
+		return fmt.Errorf("maximum cost %d exceeds the capacity of rate limit %q (%d)", c.max, smallest.Name, smallest.Capacity())
+	}
+	if c.max == 0 {
+		c.max = smallest.Capacity()
+	}
+	return nil
+}
+
+// Cost returns the request's cost, at least one. The method's cost is the
+// minimum; units from the query or GraphQL document can only raise it.
+func (c *Coster) Cost(r CostRequest) int {
+	cost := c.base
+	if m, ok := c.methods[r.Method]; ok {
+		cost = m
+	}
+
+	var units float64
+	if c.query != "" {
+		if v, err := strconv.ParseFloat(r.Query(c.query), 64); err == nil && v > 0 {
+			units = v
+		}
+	}
+	if c.graphQL {
+		if q := r.GraphQLQuery(); q != "" {
+			complexity, err := GraphQLComplexity(q)
+			if err != nil {
+				// Malformed, cyclic or oversized documents cannot be
+				// estimated; they cost the maximum
+				complexity = math.MaxInt32
+			}
+			units = math.Max(units, complexity)
+		}
+	}
+	if units > 0 {
+		cost = max(cost, int(math.Min(math.Ceil(units*c.perUnit), math.MaxInt32)))
+	}
+
+	cost = max(cost, 1)
+	if c.max > 0 {
+		cost = min(cost, c.max)
+	}
+	return cost
+}
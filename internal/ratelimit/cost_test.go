@@ -0,0 +1,178 @@
+package ratelimit
+
+import (
+	"testing"
+
+	"vibeway/internal/config"
+)
+
+func TestCosterCost(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.CostConfig
+		method  string
+		query   map[string]string
+		graphQL string
+		want    int
+	}{
+		{
+			name:   "default cost",
+			cfg:    config.CostConfig{Default: 3},
+			method: "GET",
+			want:   3,
+		},
+		{
+			name:   "method cost",
+			cfg:    config.CostConfig{Methods: map[string]int{"post": 10}},
+			method: "POST",
+			want:   10,
+		},
+		{
+			name:   "other methods cost the default",
+			cfg:    config.CostConfig{Methods: map[string]int{"post": 10}},
+			method: "GET",
+			want:   1,
+		},
+		{
+			name:   "query parameter",
+			cfg:    config.CostConfig{Query: "limit"},
+			method: "GET",
+			query:  map[string]string{"limit": "200"},
+			want:   200,
+		},
+		{
+			name:   "method cost is the minimum",
+			cfg:    config.CostConfig{Methods: map[string]int{"post": 10}, Query: "limit"},
+			method: "POST",
+			query:  map[string]string{"limit": "1"},
+			want:   10,
+		},
+		{
+			name:   "units above the method cost",
+			cfg:    config.CostConfig{Methods: map[string]int{"post": 10}, Query: "limit"},
+			method: "POST",
+			query:  map[string]string{"limit": "50"},
+			want:   50,
+		},
+		{
+			name:   "per unit rounds up",
+			cfg:    config.CostConfig{Query: "limit", PerUnit: 0.5},
+			method: "GET",
+			query:  map[string]string{"limit": "3"},
+			want:   2,
+		},
+		{
+			name:   "invalid query value",
+			cfg:    config.CostConfig{Query: "limit"},
+			method: "GET",
+			query:  map[string]string{"limit": "all"},
+			want:   1,
+		},
+		{
+			name:   "capped at max",
+			cfg:    config.CostConfig{Query: "limit", Max: 100},
+			method: "GET",
+			query:  map[string]string{"limit": "5000"},
+			want:   100,
+		},
+		{
+			name:    "graphql complexity",
+			cfg:     config.CostConfig{GraphQL: true},
+			method:  "POST",
+			graphQL: "{ users(first: 10) { id name } }",
+			want:    21,
+		},
+		{
+			name:    "larger of query and graphql",
+			cfg:     config.CostConfig{GraphQL: true, Query: "limit"},
+			method:  "POST",
+			query:   map[string]string{"limit": "40"},
+			graphQL: "{ a }",
+			want:    40,
+		},
+		{
+			name:    "cyclic graphql costs the maximum",
+			cfg:     config.CostConfig{GraphQL: true, Max: 500},
+			method:  "POST",
+			graphQL: "{ ...F } fragment F on T { a ...F }",
+			want:    500,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewCoster(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewCoster: %v", err)
+			}
+			if c == nil {
+				t.Fatal("NewCoster returned nil for a weighted config")
+			}
+			got := c.Cost(CostRequest{
+				Method:       tt.method,
+				Query:        func(name string) string { return tt.query[name] },
+				GraphQLQuery: func() string { return tt.graphQL },
+			})
+			if got != tt.want {
+				t.Errorf("Cost = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCosterTrivial(t *testing.T) {
+	c, err := NewCoster(config.CostConfig{Default: 1})
+	if c != nil || err != nil {
+		t.Errorf("NewCoster = %v, %v; want nil, nil for a cost of one", c, err)
+	}
+}
+
+func TestCosterFit(t *testing.T) {
+	limit := func(cfg config.LimitConfig) Limit {
+		t.Helper()
+		l, err := NewLimit("test", cfg)
+		if err != nil {
+			t.Fatalf("NewLimit: %v", err)
+		}
+		return l
+	}
+	bucket := limit(config.LimitConfig{Algorithm: TokenBucket, Limit: 10, WindowSeconds: 1, Burst: 200})
+	window := limit(config.LimitConfig{Algorithm: FixedWindow, Limit: 50, WindowSeconds: 60})
+	gcra := limit(config.LimitConfig{Algorithm: GCRA, Limit: 1000, WindowSeconds: 60})
+
+	tests := []struct {
+		name    string
+		max     int
+		limits  []Limit
+		want    int // Cost of a request asking for 10000 units
+		wantErr bool
+	}{
+		{name: "max defaults to the smallest capacity", limits: []Limit{bucket, gcra}, want: 200},
+		{name: "window limits cap at their limit", limits: []Limit{bucket, window}, want: 50},
+		{name: "max within capacity", max: 100, limits: []Limit{bucket, gcra}, want: 100},
+		{name: "max beyond capacity", max: 1000, limits: []Limit{bucket, gcra}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewCoster(config.CostConfig{Query: "limit", Max: tt.max})
+			if err != nil {
+				t.Fatalf("NewCoster: %v", err)
+			}
+			err = c.Fit(tt.limits)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Fit succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fit: %v", err)
+			}
+			got := c.Cost(CostRequest{Method: "GET", Query: func(string) string { return "10000" }})
+			if got != tt.want {
+				t.Errorf("Cost = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,424 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// maxGraphQLTokens bounds the work spent on a document; longer ones are
+// rejected rather than estimated.
+const maxGraphQLTokens = 10000
+
+// Arguments that multiply the complexity of a field's selections.
+var pageArguments = map[string]bool{"first": true, "last": true, "limit": true}
+
+// GraphQLComplexity estimates the cost of a GraphQL document: every field
+// counts one, plus its selections times its first, last or limit argument.
+// Fragment spreads count as the fragment's selections; variables count as 1.
+// Documents with cyclic fragment spreads or more than maxGraphQLTokens
+// tokens are rejected.
+func GraphQLComplexity(query string) (float64, error) {
+	p := &gqlParser{lex: gqlLexer{src: query}}
+	p.next()
+
+	var operations []*gqlSelection
+	fragments := make(map[string]*gqlSelection)
+	for p.tok.kind != gqlEOF {
+		switch {
+		case p.tok.kind == gqlPunct && p.tok.val == "{":
+			set, err := p.selectionSet()
+			if err != nil {
+				return 0, err
+			}
+			operations = append(operations, set)
+		case p.tok.kind == gqlName && p.tok.val == "fragment":
+			p.next()
+			name := p.tok.val
+			if err := p.skipTo("{"); err != nil {
+				return 0, err
+			}
+			set, err := p.selectionSet()
+			if err != nil {
+				return 0, err
+			}
+			fragments[name] = set
+		case p.tok.kind == gqlName:
+			// query, mutation or subscription with name, variables, directives
+			if err := p.skipTo("{"); err != nil {
+				return 0, err
+			}
+		default:
+			return 0, fmt.Errorf("unexpected %q", p.tok.val)
+		}
+		if p.err != nil {
+			return 0, p.err
+		}
+	}
+
+	f := &gqlFragments{
+		sets:     fragments,
+		memo:     make(map[string]float64, len(fragments)),
+		visiting: make(map[string]bool),
+	}
+	var total float64
+	for _, op := range operations {
+		c, err := op.complexity(f)
+		if err != nil {
+			return 0, err
+		}
+		total = math.Min(total+c, math.MaxInt32)
+	}
+	return total, nil
+}
+
+type gqlSelection struct {
+	fields  []gqlField
+	spreads []string
+	inline  []*gqlSelection
+}
+
+type gqlField struct {
+	multiplier float64
+	children   *gqlSelection
+}
+
+func (s *gqlSelection) complexity(f *gqlFragments) (float64, error) {
+	if s == nil {
+		return 0, nil
+	}
+	var total float64
+	for _, field := range s.fields {
+		c, err := field.children.complexity(f)
+		if err != nil {
+			return 0, err
+		}
+		total += 1 + field.multiplier*c
+	}
+	for _, name := range s.spreads {
+		c, err := f.complexity(name)
+		if err != nil {
+			return 0, err
+		}
+		total += c
+	}
+	for _, in := range s.inline {
+		c, err := in.complexity(f)
+		if err != nil {
+			return 0, err
+		}
+		total += c
+	}
+	return math.Min(total, math.MaxInt32), nil
+}
+
+// gqlFragments evaluates each fragment once, however often it is spread.
+type gqlFragments struct {
+	sets     map[string]*gqlSelection
+	memo     map[string]float64
+	visiting map[string]bool // Fragments being evaluated, to catch cycles
+}
+
+func (f *gqlFragments) complexity(name string) (float64, error) {
+	if c, ok := f.memo[name]; ok {
+		return c, nil
+	}
+	if f.visiting[name] {
+		return 0, fmt.Errorf("fragment %q spreads itself", name)
+	}
+	f.visiting[name] = true
+	c, err := f.sets[name].complexity(f)
+	delete(f.visiting, name)
+	if err != nil {
+		return 0, err
+	}
+	f.memo[name] = c
+	return c, nil
+}
+
+type gqlParser struct {
+	lex gqlLexer
+	tok gqlToken
+	err error
+}
+
+func (p *gqlParser) next() {
+	if p.err != nil {
+		p.tok = gqlToken{kind: gqlEOF}
+		return
+	}
+	p.tok, p.err = p.lex.next()
+}
+
+func (p *gqlParser) is(val string) bool {
+	return p.tok.kind == gqlPunct && p.tok.val == val
+}
+
+// skipTo advances to the next top-level occurrence of punctuator val,
+// skipping over anything in parentheses.
+func (p *gqlParser) skipTo(val string) error {
+	depth := 0
+	for p.tok.kind != gqlEOF {
+		switch {
+		case depth == 0 && p.is(val):
+			return nil
+		case p.is("("):
+			depth++
+		case p.is(")"):
+			depth--
+		}
+		p.next()
+	}
+	if p.err != nil {
+		return p.err
+	}
+	return fmt.Errorf("expected %q", val)
+}
+
+func (p *gqlParser) selectionSet() (*gqlSelection, error) {
+	if !p.is("{") {
+		return nil, errors.New("expected selection set")
+	}
+	p.next()
+
+	set := &gqlSelection{}
+	for !p.is("}") {
+		if p.tok.kind == gqlEOF {
+			if p.err != nil {
+				return nil, p.err
+			}
+			return nil, errors.New("unterminated selection set")
+		}
+
+		if p.is("...") {
+			p.next()
+			if p.tok.kind == gqlName && p.tok.val != "on" {
+				set.spreads = append(set.spreads, p.tok.val)
+				p.next()
+				p.skipDirectives()
+				continue
+			}
+			// Inline fragment, with or without a type condition
+			if err := p.skipTo("{"); err != nil {
+				return nil, err
+			}
+			inline, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			set.inline = append(set.inline, inline)
+			continue
+		}
+
+		if p.tok.kind != gqlName {
+			return nil, fmt.Errorf("unexpected %q in selection set", p.tok.val)
+		}
+		p.next()
+		if p.is(":") { // Alias
+			p.next()
+			if p.tok.kind != gqlName {
+				return nil, errors.New("expected field name after alias")
+			}
+			p.next()
+		}
+
+		field := gqlField{multiplier: 1}
+		if p.is("(") {
+			m, err := p.arguments()
+			if err != nil {
+				return nil, err
+			}
+			field.multiplier = m
+		}
+		p.skipDirectives()
+		if p.is("{") {
+			children, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			field.children = children
+		}
+		set.fields = append(set.fields, field)
+	}
+	p.next()
+	return set, nil
+}
+
+// arguments parses a field's arguments and returns the page size they ask
+// for, or 1.
+func (p *gqlParser) arguments() (float64, error) {
+	multiplier := 1.0
+	p.next() // (
+	for !p.is(")") {
+		if p.tok.kind != gqlName {
+			return 0, errors.New("expected argument name")
+		}
+		name := p.tok.val
+		p.next()
+		if !p.is(":") {
+			return 0, errors.New("expected ':' after argument name")
+		}
+		p.next()
+		if pageArguments[name] && p.tok.kind == gqlNumber {
+			if n, err := strconv.ParseFloat(p.tok.val, 64); err == nil && n > multiplier {
+				multiplier = n
+			}
+		}
+		if err := p.skipValue(); err != nil {
+			return 0, err
+		}
+	}
+	p.next()
+	return multiplier, nil
+}
+
+func (p *gqlParser) skipValue() error {
+	switch {
+	case p.is("$"):
+		p.next()
+		p.next()
+	case p.is("[") || p.is("{"):
+		closing := map[string]string{"[": "]", "{": "}"}[p.tok.val]
+		p.next()
+		for !p.is(closing) {
+			if p.tok.kind == gqlEOF {
+				return errors.New("unterminated value")
+			}
+			if p.is(":") {
+				p.next()
+				continue
+			}
+			if err := p.skipValue(); err != nil {
+				return err
+			}
+		}
+		p.next()
+	case p.tok.kind == gqlEOF:
+		return errors.New("expected value")
+	default:
+		p.next()
+	}
+	return p.err
+}
+
+func (p *gqlParser) skipDirectives() {
+	for p.is("@") {
+		p.next() // @
+		p.next() // name
+		if p.is("(") {
+			p.next()
+			p.skipTo(")")
+			p.next()
+		}
+	}
+}
+
+type gqlKind int
+
+const (
+	gqlEOF gqlKind = iota
+	gqlPunct
+	gqlName
+	gqlNumber
+	gqlString
+)
+
+type gqlToken struct {
+	kind gqlKind
+	val  string
+}
+
+type gqlLexer struct {
+	src    string
+	pos    int
+	tokens int
+}
+
+func (l *gqlLexer) next() (gqlToken, error) {
+	// Commas are insignificant, like whitespace
+	for l.pos < len(l.src) {
+		ch := l.src[l.pos]
+		if ch == '#' {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+			continue
+		}
+		if ch != ' ' && ch != '\t' && ch != '\n' && ch != '\r' && ch != ',' {
+			break
+		}
+		l.pos++
+	}
+	if l.pos >= len(l.src) {
+		return gqlToken{kind: gqlEOF}, nil
+	}
+	if l.tokens++; l.tokens > maxGraphQLTokens {
+		return gqlToken{}, fmt.Errorf("document exceeds %d tokens", maxGraphQLTokens)
+	}
+
+	start := l.pos
+	ch := l.src[l.pos]
+	switch {
+	case ch == '.':
+		if len(l.src)-l.pos >= 3 && l.src[l.pos:l.pos+3] == "..." {
+			l.pos += 3
+			return gqlToken{kind: gqlPunct, val: "..."}, nil
+		}
+		return gqlToken{}, errors.New("unexpected '.'")
+	case ch == '"':
+		return l.string()
+	case ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z':
+		for l.pos < len(l.src) && isNameChar(l.src[l.pos]) {
+			l.pos++
+		}
+		return gqlToken{kind: gqlName, val: l.src[start:l.pos]}, nil
+	case ch == '-' || ch >= '0' && ch <= '9':
+		l.pos++
+		for l.pos < len(l.src) && (isNameChar(l.src[l.pos]) || l.src[l.pos] == '.' ||
+			(l.src[l.pos] == '-' || l.src[l.pos] == '+') && (l.src[l.pos-1] == 'e' || l.src[l.pos-1] == 'E')) {
+			l.pos++
+		}
+		return gqlToken{kind: gqlNumber, val: l.src[start:l.pos]}, nil
+	}
+
+	switch ch {
+	case '{', '}', '(', ')', '[', ']', ':', '!', '$', '@', '=', '|', '&':
+		l.pos++
+		return gqlToken{kind: gqlPunct, val: string(ch)}, nil
+	}
+	return gqlToken{}, fmt.Errorf("unexpected character %q", ch)
+}
+
+func (l *gqlLexer) string() (gqlToken, error) {
+	if len(l.src)-l.pos >= 3 && l.src[l.pos:l.pos+3] == `"""` {
+		for i := l.pos + 3; i+3 <= len(l.src); i++ {
+			if l.src[i] == '\\' && i+4 <= len(l.src) && l.src[i+1:i+4] == `"""` {
+				i += 3
+				continue
+			}
+			if l.src[i:i+3] == `"""` {
+				l.pos = i + 3
+				return gqlToken{kind: gqlString}, nil
+			}
+		}
+		return gqlToken{}, errors.New("unterminated block string")
+	}
+
+	for i := l.pos + 1; i < len(l.src); i++ {
+		switch l.src[i] {
+		case '\\':
+			i++
+		case '"':
+			l.pos = i + 1
+			return gqlToken{kind: gqlString}, nil
+		case '\n':
+			return gqlToken{}, errors.New("unterminated string")
+		}
+	}
+	return gqlToken{}, errors.New("unterminated string")
+}
+
+func isNameChar(ch byte) bool {
+	return ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9'
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGraphQLComplexity(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    float64
+		wantErr bool
+	}{
+		{name: "flat fields", query: "{ a b c }", want: 3},
+		{name: "page size multiplies selections", query: "{ users(first: 10) { id name } }", want: 21},
+		{name: "nested pages", query: "{ users(first: 10) { posts(last: 5) { id } } }", want: 61},
+		{name: "largest page argument wins", query: "{ users(first: 2, limit: 7) { id } }", want: 8},
+		{name: "variables count as one", query: "query Q($n: Int = 50) { users(first: $n) { id } }", want: 2},
+		{name: "alias", query: "{ admins: users(limit: 3) { id } }", want: 4},
+		{name: "named fragment", query: "{ users(first: 2) { ...F } } fragment F on User { id name }", want: 5},
+		{name: "inline fragment", query: "{ node { ... on User { id } ... { name } } }", want: 3},
+		{name: "directives", query: `{ a @include(if: true) { b @skip(if: false) } }`, want: 2},
+		{name: "strings and comments", query: "{ a(filter: \"} {\") # }\n b(q: \"\"\"x\"\"\") }", want: 2},
+		{name: "several operations", query: "query A { a } mutation B { b { c } }", want: 3},
+		{name: "unknown fragment counts nothing", query: "{ ...Missing a }", want: 1},
+		{name: "fragment spread repeatedly", query: "{ ...F ...F } fragment F on T { a b }", want: 4},
+		{name: "self-spreading fragment", query: "{ ...F } fragment F on T { a ...F }", wantErr: true},
+		{name: "fragment cycle", query: "{ ...A } fragment A on T { b { ...B } } fragment B on T { ...A }", wantErr: true},
+		{name: "unterminated selection set", query: "{ a { b }", wantErr: true},
+		{name: "missing argument name", query: "{ a(: 1) }", wantErr: true},
+		{name: "unterminated string", query: `{ a(s: "x) }`, wantErr: true},
+		{name: "too many tokens", query: "{" + strings.Repeat(" a", maxGraphQLTokens) + " }", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GraphQLComplexity(tt.query)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GraphQLComplexity = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GraphQLComplexity: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("GraphQLComplexity = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphQLComplexityFragmentFanOut(t *testing.T) {
+	// Every fragment spreads the next one twice: 2^40 expansions unless
+	// each fragment is evaluated once
+	var b strings.Builder
+	b.WriteString("{ ...F0 }\n")
+	for i := range 40 {
+		fmt.Fprintf(&b, "fragment F%d on T { a: x { ...F%d } b: x { ...F%d } }\n", i, i+1, i+1)
+	}
+	b.WriteString("fragment F40 on T { id }")
+
+	start := time.Now()
+	got, err := GraphQLComplexity(b.String())
+	if err != nil {
+		t.Fatalf("GraphQLComplexity: %v", err)
+	}
+	if got != math.MaxInt32 {
+		t.Errorf("GraphQLComplexity = %v, want it capped at %d", got, math.MaxInt32)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GraphQLComplexity took %v", elapsed)
+	}
+}
@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"vibeway/internal/config"
+)
+
+// Algorithms understood by the limit script.
+const (
+	FixedWindow   = "fixed_window"
+	SlidingLog    = "sliding_log"
+	SlidingWindow = "sliding_window"
+	TokenBucket   = "token_bucket"
+	GCRA          = "gcra"
+)
+
+// Key dimensions.
+const (
+	DimRoute        = "route"
+	DimIP           = "ip"
+	DimMethod       = "method"
+	DimSubject      = "sub"
+	DimAPIKey       = "api_key"
+	DimConsumer     = "consumer" // JWT subject, else API key
+	DimClaimPrefix  = "claim:"
+	DimHeaderPrefix = "header:"
+)
+
+const defaultWindow = time.Minute
+
+var defaultKey = []string{DimRoute, DimIP}
+
+// Limit is a validated rate limit of Limit requests per Window.
+type Limit struct {
+	Name      string
+	Tier      string
+	Algorithm string
+	Limit     int
+	Window    time.Duration
+	Burst     int
+	Key       []string // Dimensions, see config.LimitConfig
+}
+
+// NewLimit validates cfg and fills in the defaults.
+func NewLimit(name string, cfg config.LimitConfig) (Limit, error) {
+	l := Limit{
+		Name:      name,
+		Algorithm: cfg.Algorithm,
+		Limit:     cfg.Limit,
+		Window:    time.Duration(cfg.WindowSeconds) * time.Second,
+		Burst:     cfg.Burst,
+		Key:       cfg.Key,
+	}
+	if l.Algorithm == "" {
+		l.Algorithm = SlidingWindow
+	}
+	switch l.Algorithm {
+	case FixedWindow, SlidingLog, SlidingWindow, TokenBucket, GCRA:
+	default:
+		return Limit{}, fmt.Errorf("unknown rate limit algorithm %q", l.Algorithm)
+	}
+	if l.Limit <= 0 {
+		return Limit{}, fmt.Errorf("rate limit must be positive, got %d", l.Limit)
+	}
+	if l.Window <= 0 {
+		l.Window = defaultWindow
+	}
+	if l.Burst <= 0 {
+		l.Burst = l.Limit
+	}
+	if l.Key == nil {
+		l.Key = defaultKey
+	}
+	for _, dim := range l.Key {
+		if !validDimension(dim) {
+			return Limit{}, fmt.Errorf("unknown rate limit key dimension %q", dim)
+		}
+	}
+	return l, nil
+}
+
+func validDimension(dim string) bool {
+	switch dim {
+	case DimRoute, DimIP, DimMethod, DimSubject, DimAPIKey, DimConsumer:
+		return true
+	}
+	if name, ok := strings.CutPrefix(dim, DimClaimPrefix); ok {
+		return name != ""
+	}
+	if name, ok := strings.CutPrefix(dim, DimHeaderPrefix); ok {
+		return name != ""
+	}
+	return false
+}
+
+// RedisKey builds the counter key from the value of each key dimension.
+// Limits are namespaced by name and algorithm, which store different types.
+func (l Limit) RedisKey(value func(dim string) string) string {
+	var b strings.Builder
+	b.WriteString("ratelimit:")
+	b.WriteString(l.Name)
+	b.WriteString(":")
+	b.WriteString(l.Algorithm)
+	for i, dim := range l.Key {
+		if i == 0 {
+			b.WriteString(":")
+		} else {
+			b.WriteString("|")
+		}
+		b.WriteString(value(dim))
+	}
+	return b.String()
+}
+
+// Capacity is the most a single request can spend: the bucket size of
+// token_bucket and gcra, else the limit per window.
+func (l Limit) Capacity() int {
+	if l.Algorithm == TokenBucket || l.Algorithm == GCRA {
+		return l.Burst
+	}
+	return l.Limit
+}
+
+// Policy renders the limit for the RateLimit-Policy header.
+func (l Limit) Policy() string {
+	return fmt.Sprintf("%q;q=%d;w=%d", l.Name, l.Limit, int(l.Window.Seconds()))
+}
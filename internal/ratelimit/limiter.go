@@ -0,0 +1,219 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"vibeway/internal/config"
+	"vibeway/internal/metrics"
+	"vibeway/internal/upstream"
+	"vibeway/pkg/logger"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Request asks for cost units of one limit under key.
+type Request struct {
+	Key   string
+	Limit Limit
+	Cost  int
+}
+
+// Result is the state of one limit after a check.
+type Result struct {
+	Limit      Limit
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration // Until the limit is fully replenished
+	RetryAfter time.Duration // Until the request would be allowed, if it was not
+}
+
+// Decision is the outcome of checking all limits of a request. Nothing is
+// consumed unless every limit allows the request.
+type Decision struct {
+	Allowed bool
+	Results []Result
+}
+
+// Tightest returns the result to report to the client: the rejecting limit
+// with the longest wait, or else the one with the fewest requests left.
+func (d Decision) Tightest() Result {
+	var tightest Result
+	for i, r := range d.Results {
+		switch {
+		case i == 0:
+			tightest = r
+		case !d.Allowed:
+			if !r.Allowed && (tightest.Allowed || r.RetryAfter > tightest.RetryAfter) {
+				tightest = r
+			}
+		case r.Remaining < tightest.Remaining:
+			tightest = r
+		}
+	}
+	return tightest
+}
+
+// Policies renders all limits for the RateLimit-Policy header.
+func (d Decision) Policies() string {
+	policies := make([]string, 0, len(d.Results))
+	for _, r := range d.Results {
+		policies = append(policies, r.Limit.Policy())
+	}
+	return strings.Join(policies, ", ")
+}
+
+// Modes the limiter runs in; all but ModeRedis are failure modes.
+const (
+	ModeRedis      = "redis"
+	ModeLocal      = "local"
+	ModeFailOpen   = "fail_open"
+	ModeFailClosed = "fail_closed"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerReset     = 10 * time.Second
+)
+
+// ErrUnavailable is returned in fail_closed mode while Redis is unreachable.
+var ErrUnavailable = errors.New("rate limiter unavailable")
+
+// Limiter evaluates rate limits atomically in Redis. While Redis is
+// unreachable it falls back to the configured failure mode; a circuit breaker
+// keeps requests from waiting on Redis timeouts meanwhile.
+type Limiter struct {
+	client      *redis.Client
+	failureMode string
+	breaker     *upstream.CircuitBreaker
+	local       *localLimiter
+
+	mode atomic.Value // string, the mode of the last decision
+}
+
+func NewLimiter(client *redis.Client, cfg config.RateLimitConfig) *Limiter {
+	threshold := cfg.RedisBreaker.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultBreakerThreshold
+	}
+	reset := time.Duration(cfg.RedisBreaker.ResetTimeoutMs) * time.Millisecond
+	if reset <= 0 {
+		reset = defaultBreakerReset
+	}
+
+	l := &Limiter{
+		client:      client,
+		failureMode: cfg.FailureMode,
+		breaker:     upstream.NewCircuitBreaker(threshold, reset),
+	}
+	switch l.failureMode {
+	case "":
+		l.failureMode = ModeFailOpen
+	case ModeFailOpen, ModeFailClosed:
+	case ModeLocal:
+		l.local = newLocalLimiter(cfg.Instances)
+	default:
+		logger.Warn("Unknown rate limit failure mode, failing open", map[string]interface{}{"failure_mode": cfg.FailureMode})
+		l.failureMode = ModeFailOpen
+	}
+
+	l.setMode(ModeRedis)
+	return l
+}
+
+// Breaker returns the circuit breaker guarding Redis. Quotas and plan
+// lookups share it, so one outage trips them all at once.
+func (l *Limiter) Breaker() *upstream.CircuitBreaker {
+	return l.breaker
+}
+
+// Allow checks and, if all allow it, consumes every request in one round
+// trip. Without Redis it answers according to the failure mode: an allowing
+// decision without results (fail_open), ErrUnavailable (fail_closed) or the
+// local limiter's decision.
+func (l *Limiter) Allow(ctx context.Context, reqs ...Request) (Decision, error) {
+	if l.client != nil && l.breaker.Allow() {
+		d, err := l.allowRedis(ctx, reqs)
+		if err == nil {
+			l.breaker.RecordSuccess()
+			l.setMode(ModeRedis)
+			return d, nil
+		}
+		l.breaker.RecordFailure()
+		logger.Warn("Rate limit redis error", map[string]interface{}{
+			"error":        err.Error(),
+			"failure_mode": l.failureMode,
+		})
+	}
+
+	l.setMode(l.failureMode)
+	switch l.failureMode {
+	case ModeLocal:
+		return l.local.allow(reqs, time.Now()), nil
+	case ModeFailClosed:
+		return Decision{}, ErrUnavailable
+	default:
+		return Decision{Allowed: true}, nil
+	}
+}
+
+// Mode returns the mode of the most recent decision.
+func (l *Limiter) Mode() string {
+	return l.mode.Load().(string)
+}
+
+func (l *Limiter) setMode(mode string) {
+	prev, _ := l.mode.Swap(mode).(string)
+	if prev == mode {
+		return
+	}
+	if prev != "" {
+		metrics.RateLimiterMode.WithLabelValues(prev).Set(0)
+		logger.Warn("Rate limiter mode changed", map[string]interface{}{"from": prev, "to": mode})
+	}
+	metrics.RateLimiterMode.WithLabelValues(mode).Set(1)
+}
+
+func (l *Limiter) allowRedis(ctx context.Context, reqs []Request) (Decision, error) {
+	keys := make([]string, 0, len(reqs))
+	args := make([]interface{}, 0, len(reqs)*5)
+	for _, r := range reqs {
+		cost := r.Cost
+		if cost <= 0 {
+			cost = 1
+		}
+		keys = append(keys, r.Key)
+		args = append(args, r.Limit.Algorithm, r.Limit.Limit, r.Limit.Window.Milliseconds(), r.Limit.Burst, cost)
+	}
+
+	reply, err := limitScript.Run(ctx, l.client, keys, args...).Int64Slice()
+	if err != nil {
+		return Decision{}, err
+	}
+	if len(reply) != 1+4*len(reqs) {
+		return Decision{}, fmt.Errorf("unexpected rate limit reply of length %d", len(reply))
+	}
+
+	d := Decision{Allowed: reply[0] == 1, Results: make([]Result, len(reqs))}
+	for i, r := range reqs {
+		v := reply[1+4*i:]
+		d.Results[i] = Result{
+			Limit:      r.Limit,
+			Allowed:    v[0] == 1,
+			Remaining:  int(v[1]),
+			Reset:      time.Duration(v[2]) * time.Millisecond,
+			RetryAfter: time.Duration(v[3]) * time.Millisecond,
+		}
+	}
+	return d, nil
+}
+
+// Seconds rounds a duration up to whole seconds for headers.
+func Seconds(d time.Duration) string {
+	return strconv.Itoa(int((d + time.Second - 1) / time.Second))
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const localSweepInterval = time.Minute
+
+// localLimiter is the in-process fallback used while Redis is unreachable.
+// Whatever the configured algorithm, each limit becomes a token bucket
+// holding this instance's share of the cluster-wide limit.
+type localLimiter struct {
+	instances int
+
+	mu      sync.Mutex
+	buckets map[string]*localBucket
+}
+
+type localBucket struct {
+	tokens float64
+	last   time.Time
+	refill time.Duration // From empty to full
+}
+
+func newLocalLimiter(instances int) *localLimiter {
+	l := &localLimiter{
+		instances: max(instances, 1),
+		buckets:   make(map[string]*localBucket),
+	}
+	go l.sweep()
+	return l
+}
+
+func (l *localLimiter) allow(reqs []Request, now time.Time) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	type check struct {
+		bucket *localBucket
+		tokens float64
+		cost   float64
+	}
+	checks := make([]check, len(reqs))
+	d := Decision{Allowed: true, Results: make([]Result, len(reqs))}
+
+	for i, r := range reqs {
+		limit := math.Max(float64(r.Limit.Limit)/float64(l.instances), 1)
+		burst := math.Max(float64(r.Limit.Burst)/float64(l.instances), 1)
+		rate := limit / float64(r.Limit.Window) // Tokens per nanosecond
+		cost := float64(max(r.Cost, 1))
+
+		b, ok := l.buckets[r.Key]
+		if !ok {
+			b = &localBucket{tokens: burst, last: now, refill: time.Duration(burst / rate)}
+			l.buckets[r.Key] = b
+		}
+		tokens := math.Min(burst, b.tokens+float64(now.Sub(b.last))*rate)
+		checks[i] = check{bucket: b, tokens: tokens, cost: cost}
+
+		res := Result{Limit: r.Limit, Allowed: tokens >= cost}
+		if res.Allowed {
+			res.Remaining = int(tokens - cost)
+			res.Reset = time.Duration((burst - tokens + cost) / rate)
+		} else {
+			d.Allowed = false
+			res.Remaining = int(tokens)
+			res.RetryAfter = time.Duration((cost - tokens) / rate)
+			res.Reset = time.Duration((burst - tokens) / rate)
+		}
+		d.Results[i] = res
+	}
+
+	if d.Allowed {
+		for _, c := range checks {
+			c.bucket.tokens = c.tokens - c.cost
+			c.bucket.last = now
+		}
+	}
+	return d
+}
+
+// sweep drops buckets that have refilled completely; they would be
+// recreated full anyway.
+func (l *localLimiter) sweep() {
+	for range time.Tick(localSweepInterval) {
+		now := time.Now()
+		l.mu.Lock()
+		for key, b := range l.buckets {
+			if now.Sub(b.last) >= b.refill {
+				delete(l.buckets, key)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
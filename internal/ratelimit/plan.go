@@ -0,0 +1,208 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"vibeway/internal/config"
+	"vibeway/internal/upstream"
+	"vibeway/pkg/logger"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultPlanCacheTTL = 5 * time.Second
+	maxCachedPlans      = 10000
+)
+
+var ErrUnknownPlan = errors.New("unknown rate limit plan")
+
+// Plans resolves consumers to their rate limit plan. Assignments live in
+// Redis and are cached for a short TTL, so a change reaches every instance
+// within seconds. Lookups go through the limiter's Redis breaker.
+type Plans struct {
+	client      *redis.Client
+	breaker     *upstream.CircuitBreaker
+	plans       map[string][]Limit
+	defaultPlan string
+	ttl         time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedPlan // By consumer
+}
+
+type cachedPlan struct {
+	plan    string // Empty if none is assigned
+	expires time.Time
+}
+
+// NewPlans returns nil if cfg defines no plans.
+func NewPlans(client *redis.Client, cfg config.RateLimitConfig, breaker *upstream.CircuitBreaker) (*Plans, error) {
+	if len(cfg.Plans) == 0 {
+		return nil, nil
+	}
+
+	p := &Plans{
+		client:      client,
+		breaker:     breaker,
+		plans:       make(map[string][]Limit, len(cfg.Plans)),
+		defaultPlan: cfg.DefaultPlan,
+		ttl:         time.Duration(cfg.PlanCacheTTLSeconds) * time.Second,
+		cache:       make(map[string]cachedPlan),
+	}
+	if p.ttl <= 0 {
+		p.ttl = defaultPlanCacheTTL
+	}
+
+	for name, cfgs := range cfg.Plans {
+		if len(cfgs) == 0 {
+			return nil, fmt.Errorf("plan %q has no limits", name)
+		}
+		limits := make([]Limit, 0, len(cfgs))
+		for i, lCfg := range cfgs {
+			if lCfg.Algorithm == "" {
+				lCfg.Algorithm = cfg.Algorithm
+			}
+			if lCfg.WindowSeconds == 0 {
+				lCfg.WindowSeconds = cfg.WindowSeconds
+			}
+			if lCfg.Key == nil {
+				lCfg.Key = []string{DimConsumer}
+			}
+			// Unnamed limits share counters by position across plans, so
+			// switching plans does not reset a consumer's usage
+			limitName := lCfg.Name
+			if limitName == "" {
+				limitName = fmt.Sprintf("plan:%d", i)
+			}
+			limit, err := NewLimit(limitName, lCfg)
+			if err != nil {
+				return nil, fmt.Errorf("plan %q: rate limit %q: %w", name, limitName, err)
+			}
+			limit.Tier = TierConsumer
+			limits = append(limits, limit)
+		}
+		p.plans[name] = limits
+	}
+
+	if p.defaultPlan != "" {
+		if _, ok := p.plans[p.defaultPlan]; !ok {
+			return nil, fmt.Errorf("default plan %q is not defined", p.defaultPlan)
+		}
+	}
+	return p, nil
+}
+
+// Names returns the plan names, sorted.
+func (p *Plans) Names() []string {
+	names := make([]string, 0, len(p.plans))
+	for name := range p.plans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Limits returns the limits of a plan.
+func (p *Plans) Limits(plan string) ([]Limit, bool) {
+	limits, ok := p.plans[plan]
+	return limits, ok
+}
+
+// Default returns the plan of consumers without an assignment, if any.
+func (p *Plans) Default() string {
+	return p.defaultPlan
+}
+
+// Resolve returns the consumer's plan, or the default plan, and its limits.
+// It returns false if the consumer has neither. While Redis is unreachable
+// the last known assignment is kept, and uncached consumers get the default
+// plan.
+func (p *Plans) Resolve(ctx context.Context, consumer string) (string, []Limit, bool) {
+	now := time.Now()
+
+	p.mu.Lock()
+	entry, cached := p.cache[consumer]
+	p.mu.Unlock()
+
+	if (!cached || now.After(entry.expires)) && p.breaker.Allow() {
+		plan, err := p.Assigned(ctx, consumer)
+		if err != nil {
+			p.breaker.RecordFailure()
+			logger.Warn("Rate limit plan lookup failed", map[string]interface{}{"consumer": consumer, "error": err.Error()})
+		} else {
+			p.breaker.RecordSuccess()
+			entry.plan = plan
+		}
+		// Failed lookups are retried after the TTL too
+		entry.expires = now.Add(p.ttl)
+		p.store(consumer, entry)
+	}
+
+	plan := entry.plan
+	if _, ok := p.plans[plan]; !ok {
+		// Unassigned, or assigned a plan this instance does not know
+		plan = p.defaultPlan
+	}
+	if plan == "" {
+		return "", nil, false
+	}
+	return plan, p.plans[plan], true
+}
+
+// Assigned returns the plan assigned to the consumer in Redis, or "".
+func (p *Plans) Assigned(ctx context.Context, consumer string) (string, error) {
+	plan, err := p.client.Get(ctx, planKey(consumer)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return plan, err
+}
+
+// Assign stores the consumer's plan. Other instances pick it up once their
+// cached assignment expires.
+func (p *Plans) Assign(ctx context.Context, consumer, plan string) error {
+	if _, ok := p.plans[plan]; !ok {
+		return ErrUnknownPlan
+	}
+	if err := p.client.Set(ctx, planKey(consumer), plan, 0).Err(); err != nil {
+		return err
+	}
+	p.store(consumer, cachedPlan{plan: plan, expires: time.Now().Add(p.ttl)})
+	return nil
+}
+
+// Unassign returns the consumer to the default plan.
+func (p *Plans) Unassign(ctx context.Context, consumer string) error {
+	if err := p.client.Del(ctx, planKey(consumer)).Err(); err != nil {
+		return err
+	}
+	p.store(consumer, cachedPlan{expires: time.Now().Add(p.ttl)})
+	return nil
+}
+
+func (p *Plans) store(consumer string, entry cachedPlan) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.cache) >= maxCachedPlans {
+		now := time.Now()
+		for k, e := range p.cache {
+			if now.After(e.expires) {
+				delete(p.cache, k)
+			}
+		}
+		if len(p.cache) >= maxCachedPlans {
+			clear(p.cache)
+		}
+	}
+	p.cache[consumer] = entry
+}
+
+func planKey(consumer string) string {
+	return "ratelimit:plan:" + consumer
+}
@@ -0,0 +1,173 @@
+package ratelimit
+
+import "github.com/redis/go-redis/v9"
+
+// limitScript checks every limit of a request first and only consumes from
+// them if all of them allow it, so a rejected request never uses up quota.
+// Time comes from the Redis server so all gateway instances agree on it.
+//
+// KEYS[i]: one key per limit
+// ARGV: five values per limit: algorithm, limit, window (ms), burst, cost
+// Returns {allowed, then per limit: allowed, remaining, reset (ms), retry after (ms)}
+var limitScript = redis.NewScript(`
+	local t = redis.call("TIME")
+	local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+	local algorithms = {}
+
+	-- Counter that resets at the end of each window
+	algorithms.fixed_window = function(key, limit, window, burst, cost)
+		local count = tonumber(redis.call("GET", key) or "0")
+		local ttl = redis.call("PTTL", key)
+		if ttl < 0 then
+			ttl = window
+		end
+
+		local c = {reset = ttl}
+		if count + cost <= limit then
+			c.allowed, c.remaining, c.retry = 1, limit - count - cost, 0
+			c.commit = function()
+				redis.call("INCRBY", key, cost)
+				if redis.call("PTTL", key) < 0 then
+					redis.call("PEXPIRE", key, window)
+				end
+			end
+		else
+			c.allowed, c.remaining, c.retry = 0, math.max(limit - count, 0), ttl
+		end
+		return c
+	end
+
+	-- Exact: one sorted set entry per request in the last window
+	algorithms.sliding_log = function(key, limit, window, burst, cost)
+		redis.call("ZREMRANGEBYSCORE", key, "-inf", now - window)
+		local count = redis.call("ZCARD", key)
+
+		local c = {}
+		if count + cost <= limit then
+			c.allowed, c.remaining, c.retry, c.reset = 1, limit - count - cost, 0, window
+			c.commit = function()
+				for j = 1, cost do
+					redis.call("ZADD", key, now, now .. ":" .. count .. ":" .. j)
+				end
+				redis.call("PEXPIRE", key, window)
+			end
+		else
+			c.allowed, c.remaining = 0, math.max(limit - count, 0)
+			-- Wait until enough of the oldest entries have left the window
+			local idx = math.min(count + cost - limit, count) - 1
+			local oldest = redis.call("ZRANGE", key, idx, idx, "WITHSCORES")
+			c.retry = oldest[2] and (tonumber(oldest[2]) + window - now) or window
+			local newest = redis.call("ZRANGE", key, -1, -1, "WITHSCORES")
+			c.reset = newest[2] and (tonumber(newest[2]) + window - now) or window
+		end
+		return c
+	end
+
+	-- Approximation: the previous window's count weighted by its overlap
+	algorithms.sliding_window = function(key, limit, window, burst, cost)
+		local idx = math.floor(now / window)
+		local h = redis.call("HMGET", key, "w", "c", "p")
+		local w, curr, prev = tonumber(h[1]), tonumber(h[2]) or 0, tonumber(h[3]) or 0
+		if w == idx - 1 then
+			prev, curr = curr, 0
+		elseif w ~= idx then
+			prev, curr = 0, 0
+		end
+
+		local elapsed = now - idx * window
+		local weight = (window - elapsed) / window
+		local estimate = prev * weight + curr
+
+		local c = {reset = window - elapsed}
+		if estimate + cost <= limit then
+			c.allowed, c.remaining, c.retry = 1, math.floor(limit - estimate - cost), 0
+			c.commit = function()
+				redis.call("HSET", key, "w", idx, "c", curr + cost, "p", prev)
+				redis.call("PEXPIRE", key, window * 2)
+			end
+		else
+			c.allowed, c.remaining = 0, math.max(math.floor(limit - estimate), 0)
+			local room = limit - curr - cost
+			if prev > 0 and room >= 0 then
+				c.retry = math.ceil((weight - room / prev) * window)
+			else
+				c.retry = window - elapsed
+			end
+		end
+		return c
+	end
+
+	-- Refills limit tokens per window up to burst
+	algorithms.token_bucket = function(key, limit, window, burst, cost)
+		local rate = limit / window
+		local h = redis.call("HMGET", key, "t", "ts")
+		local tokens = tonumber(h[1]) or burst
+		local ts = tonumber(h[2]) or now
+		tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+
+		local c = {}
+		if tokens >= cost then
+			c.allowed, c.remaining, c.retry = 1, math.floor(tokens - cost), 0
+			c.reset = math.ceil((burst - tokens + cost) / rate)
+			c.commit = function()
+				redis.call("HSET", key, "t", tokens - cost, "ts", now)
+				redis.call("PEXPIRE", key, math.ceil(burst / rate) + 1000)
+			end
+		else
+			c.allowed, c.remaining = 0, math.floor(tokens)
+			c.retry = math.ceil((cost - tokens) / rate)
+			c.reset = math.ceil((burst - tokens) / rate)
+		end
+		return c
+	end
+
+	-- Generic cell rate algorithm: stores only the theoretical arrival time
+	algorithms.gcra = function(key, limit, window, burst, cost)
+		local interval = window / limit
+		local tolerance = interval * burst
+		local tat = math.max(tonumber(redis.call("GET", key) or now), now)
+		local newTat = tat + cost * interval
+		local allowAt = newTat - tolerance
+
+		local c = {}
+		if now >= allowAt then
+			c.allowed, c.retry = 1, 0
+			c.remaining = math.floor((now - allowAt) / interval)
+			c.reset = math.ceil(newTat - now)
+			c.commit = function()
+				redis.call("SET", key, newTat, "PX", math.ceil(newTat - now))
+			end
+		else
+			c.allowed, c.retry = 0, math.ceil(allowAt - now)
+			c.remaining = math.max(math.floor((now - (tat - tolerance)) / interval), 0)
+			c.reset = math.ceil(tat - now)
+		end
+		return c
+	end
+
+	local checks = {}
+	local allowed = 1
+	for i, key in ipairs(KEYS) do
+		local base = (i - 1) * 5
+		local check = algorithms[ARGV[base + 1]](key,
+			tonumber(ARGV[base + 2]), tonumber(ARGV[base + 3]),
+			tonumber(ARGV[base + 4]), tonumber(ARGV[base + 5]))
+		if check.allowed == 0 then
+			allowed = 0
+		end
+		checks[i] = check
+	end
+
+	local out = {allowed}
+	for _, check in ipairs(checks) do
+		if allowed == 1 then
+			check.commit()
+		end
+		table.insert(out, check.allowed)
+		table.insert(out, check.remaining)
+		table.insert(out, math.max(check.reset, 0))
+		table.insert(out, math.max(check.retry, 0))
+	end
+	return out
+`)
@@ -0,0 +1,164 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"vibeway/internal/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestLimiter returns a limiter on a miniredis server whose clock starts
+// on a whole second, so window boundaries are predictable, and a function
+// that moves the clock on and expires keys accordingly.
+func newTestLimiter(t *testing.T) (*Limiter, func(d time.Duration)) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	now := time.Unix(1_700_000_000, 0)
+	mr.SetTime(now)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	advance := func(d time.Duration) {
+		now = now.Add(d)
+		mr.SetTime(now)
+		mr.FastForward(d)
+	}
+	return NewLimiter(client, config.RateLimitConfig{}), advance
+}
+
+func TestLimitScriptAlgorithms(t *testing.T) {
+	type step struct {
+		advance   time.Duration
+		cost      int
+		allowed   bool
+		remaining int
+		retry     time.Duration // Checked if set
+	}
+
+	tests := []struct {
+		name  string
+		limit config.LimitConfig
+		steps []step
+	}{
+		{
+			name:  "fixed window",
+			limit: config.LimitConfig{Algorithm: FixedWindow, Limit: 3, WindowSeconds: 1},
+			steps: []step{
+				{cost: 1, allowed: true, remaining: 2},
+				{cost: 1, allowed: true, remaining: 1},
+				{cost: 1, allowed: true, remaining: 0},
+				{cost: 1, allowed: false, remaining: 0, retry: time.Second},
+				{advance: time.Second, cost: 1, allowed: true, remaining: 2},
+			},
+		},
+		{
+			name:  "fixed window cost",
+			limit: config.LimitConfig{Algorithm: FixedWindow, Limit: 3, WindowSeconds: 1},
+			steps: []step{
+				{cost: 2, allowed: true, remaining: 1},
+				{cost: 2, allowed: false, remaining: 1},
+				{cost: 1, allowed: true, remaining: 0},
+			},
+		},
+		{
+			name:  "sliding log",
+			limit: config.LimitConfig{Algorithm: SlidingLog, Limit: 2, WindowSeconds: 1},
+			steps: []step{
+				{cost: 1, allowed: true, remaining: 1},
+				{advance: 500 * time.Millisecond, cost: 1, allowed: true, remaining: 0},
+				{cost: 1, allowed: false, remaining: 0, retry: 500 * time.Millisecond},
+				// The first entry has left the window, the second has not
+				{advance: 501 * time.Millisecond, cost: 1, allowed: true, remaining: 0},
+			},
+		},
+		{
+			name:  "sliding window",
+			limit: config.LimitConfig{Algorithm: SlidingWindow, Limit: 3, WindowSeconds: 1},
+			steps: []step{
+				{cost: 1, allowed: true, remaining: 2},
+				{cost: 1, allowed: true, remaining: 1},
+				{cost: 1, allowed: true, remaining: 0},
+				{cost: 1, allowed: false, remaining: 0},
+				// The previous window still counts fully at its end...
+				{advance: time.Second, cost: 1, allowed: false, remaining: 0},
+				// ...and by half halfway through the next one
+				{advance: 500 * time.Millisecond, cost: 1, allowed: true, remaining: 0},
+			},
+		},
+		{
+			name:  "token bucket",
+			limit: config.LimitConfig{Algorithm: TokenBucket, Limit: 10, WindowSeconds: 1, Burst: 4},
+			steps: []step{
+				{cost: 3, allowed: true, remaining: 1},
+				{cost: 2, allowed: false, remaining: 1, retry: 100 * time.Millisecond},
+				{advance: 100 * time.Millisecond, cost: 2, allowed: true, remaining: 0},
+				// Refills up to the burst only
+				{advance: 10 * time.Second, cost: 1, allowed: true, remaining: 3},
+			},
+		},
+		{
+			name:  "gcra",
+			limit: config.LimitConfig{Algorithm: GCRA, Limit: 10, WindowSeconds: 1, Burst: 2},
+			steps: []step{
+				{cost: 1, allowed: true, remaining: 1},
+				{cost: 1, allowed: true, remaining: 0},
+				{cost: 1, allowed: false, remaining: 0, retry: 100 * time.Millisecond},
+				{advance: 100 * time.Millisecond, cost: 1, allowed: true, remaining: 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, advance := newTestLimiter(t)
+			limit, err := NewLimit("test", tt.limit)
+			if err != nil {
+				t.Fatalf("NewLimit: %v", err)
+			}
+
+			for i, s := range tt.steps {
+				advance(s.advance)
+				d, err := l.Allow(context.Background(), Request{Key: "k", Limit: limit, Cost: s.cost})
+				if err != nil {
+					t.Fatalf("step %d: Allow: %v", i, err)
+				}
+				r := d.Results[0]
+				if d.Allowed != s.allowed || r.Remaining != s.remaining {
+					t.Errorf("step %d: allowed %v, remaining %d; want %v, %d", i, d.Allowed, r.Remaining, s.allowed, s.remaining)
+				}
+				if s.retry > 0 && (r.RetryAfter < s.retry-time.Millisecond || r.RetryAfter > s.retry+time.Millisecond) {
+					t.Errorf("step %d: retry after %v, want %v", i, r.RetryAfter, s.retry)
+				}
+			}
+		})
+	}
+}
+
+func TestLimitScriptConsumesNothingOnRejection(t *testing.T) {
+	l, _ := newTestLimiter(t)
+	loose, _ := NewLimit("loose", config.LimitConfig{Algorithm: FixedWindow, Limit: 10, WindowSeconds: 60})
+	tight, _ := NewLimit("tight", config.LimitConfig{Algorithm: FixedWindow, Limit: 1, WindowSeconds: 60})
+	ctx := context.Background()
+
+	for i, want := range []bool{true, false, false} {
+		d, err := l.Allow(ctx, Request{Key: "loose", Limit: loose}, Request{Key: "tight", Limit: tight})
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		if d.Allowed != want {
+			t.Errorf("request %d: allowed %v, want %v", i, d.Allowed, want)
+		}
+	}
+
+	d, err := l.Allow(ctx, Request{Key: "loose", Limit: loose})
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	if got := d.Results[0].Remaining; got != 8 {
+		t.Errorf("loose limit has %d left, want 8: rejected requests must not consume it", got)
+	}
+}
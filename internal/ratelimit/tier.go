@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"fmt"
+
+	"vibeway/internal/config"
+)
+
+// Tiers of the limit hierarchy, reported when a request is rejected.
+const (
+	TierGlobal   = "global"
+	TierIP       = "ip"
+	TierConsumer = "consumer"
+	TierRoute    = "route"
+)
+
+// GatewayLimits builds the gateway-wide tiers of cfg: one counter for all
+// traffic, one per client IP and one per consumer.
+func GatewayLimits(cfg config.RateLimitConfig) ([]Limit, error) {
+	tiers := []struct {
+		tier   string
+		limit  int
+		window int
+		key    []string
+	}{
+		// An empty, non-nil key is a single counter
+		{TierGlobal, cfg.GlobalPerMinute, 60, []string{}},
+		{TierIP, cfg.PerIP, cfg.WindowSeconds, []string{DimIP}},
+		{TierConsumer, cfg.PerConsumer, cfg.WindowSeconds, []string{DimConsumer}},
+	}
+
+	var limits []Limit
+	for _, t := range tiers {
+		if t.limit <= 0 {
+			continue
+		}
+		limit, err := NewLimit(t.tier, config.LimitConfig{
+			Algorithm:     cfg.Algorithm,
+			Limit:         t.limit,
+			WindowSeconds: t.window,
+			Key:           t.key,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s rate limit: %w", t.tier, err)
+		}
+		limit.Tier = t.tier
+		limits = append(limits, limit)
+	}
+	return limits, nil
+}
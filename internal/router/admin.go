@@ -0,0 +1,252 @@
+package router
+
+import (
+	"errors"
+	"time"
+
+	"vibeway/internal/middleware"
+	"vibeway/internal/quota"
+	"vibeway/internal/ratelimit"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// registerAdmin exposes runtime controls for the routes built by SetupRoutes.
+func registerAdmin(r fiber.Router, splitters map[string]*Splitter, faults map[string]*middleware.FaultInjector, maintenance *maintenanceSwitches, quotas *quota.Manager, plans *ratelimit.Plans) {
+	r.Get("/routes/:name/split", func(c fiber.Ctx) error {
+		s, ok := splitters[c.Params("name")]
+		if !ok {
+			return middleware.ErrorJSON(c, fiber.StatusNotFound, "Route has no traffic split")
+		}
+		return c.JSON(fiber.Map{"route": c.Params("name"), "weights": s.Weights()})
+	})
+
+	r.Put("/routes/:name/split", func(c fiber.Ctx) error {
+		s, ok := splitters[c.Params("name")]
+		if !ok {
+			return middleware.ErrorJSON(c, fiber.StatusNotFound, "Route has no traffic split")
+		}
+
+		var body struct {
+			Weights map[string]int `json:"weights"`
+		}
+		if err := c.Bind().JSON(&body); err != nil || len(body.Weights) == 0 {
+			return middleware.ErrorJSON(c, fiber.StatusBadRequest, "Body must be {\"weights\": {\"<upstream>\": <weight>}}")
+		}
+		if err := s.SetWeights(body.Weights); err != nil {
+			return middleware.ErrorJSON(c, fiber.StatusBadRequest, err.Error())
+		}
+
+		middleware.Log(c).Info("Traffic split updated", map[string]interface{}{
+			"route":   c.Params("name"),
+			"weights": s.Weights(),
+		})
+		return c.JSON(fiber.Map{"route": c.Params("name"), "weights": s.Weights()})
+	})
+
+	r.Get("/routes/:name/fault", func(c fiber.Ctx) error {
+		f, ok := faults[c.Params("name")]
+		if !ok {
+			return middleware.ErrorJSON(c, fiber.StatusNotFound, "Route has no fault injection")
+		}
+		return c.JSON(fiber.Map{"route": c.Params("name"), "enabled": f.Enabled(), "fault": f.Config()})
+	})
+
+	r.Put("/routes/:name/fault", func(c fiber.Ctx) error {
+		f, ok := faults[c.Params("name")]
+		if !ok {
+			return middleware.ErrorJSON(c, fiber.StatusNotFound, "Route has no fault injection")
+		}
+
+		var body struct {
+			Enabled *bool `json:"enabled"`
+		}
+		if err := c.Bind().JSON(&body); err != nil || body.Enabled == nil {
+			return middleware.ErrorJSON(c, fiber.StatusBadRequest, "Body must be {\"enabled\": true|false}")
+		}
+		f.SetEnabled(*body.Enabled)
+		return c.JSON(fiber.Map{"route": c.Params("name"), "enabled": f.Enabled()})
+	})
+
+	r.Get("/maintenance", func(c fiber.Ctx) error {
+		return c.JSON(maintenanceStatus("global", maintenance.global))
+	})
+	r.Put("/maintenance", func(c fiber.Ctx) error {
+		return toggleMaintenance(c, "global", maintenance.global)
+	})
+
+	r.Get("/routes/:name/maintenance", func(c fiber.Ctx) error {
+		m, ok := maintenance.routes[c.Params("name")]
+		if !ok {
+			return middleware.ErrorJSON(c, fiber.StatusNotFound, "Route not found")
+		}
+		return c.JSON(maintenanceStatus("route", m))
+	})
+	r.Put("/routes/:name/maintenance", func(c fiber.Ctx) error {
+		m, ok := maintenance.routes[c.Params("name")]
+		if !ok {
+			return middleware.ErrorJSON(c, fiber.StatusNotFound, "Route not found")
+		}
+		return toggleMaintenance(c, "route", m)
+	})
+
+	r.Get("/upstreams/:name/maintenance", func(c fiber.Ctx) error {
+		m, ok := maintenance.upstreams[c.Params("name")]
+		if !ok {
+			return middleware.ErrorJSON(c, fiber.StatusNotFound, "Upstream not found")
+		}
+		return c.JSON(maintenanceStatus("upstream", m))
+	})
+	r.Put("/upstreams/:name/maintenance", func(c fiber.Ctx) error {
+		m, ok := maintenance.upstreams[c.Params("name")]
+		if !ok {
+			return middleware.ErrorJSON(c, fiber.StatusNotFound, "Upstream not found")
+		}
+		return toggleMaintenance(c, "upstream", m)
+	})
+
+	r.Get("/quotas", func(c fiber.Ctx) error {
+		list := make([]fiber.Map, 0, len(quotas.Policies()))
+		for _, p := range quotas.Policies() {
+			list = append(list, fiber.Map{
+				"name":     p.Name,
+				"limit":    p.Limit,
+				"period":   p.Period,
+				"timezone": p.Location.String(),
+				"identity": p.Identity,
+			})
+		}
+		return c.JSON(fiber.Map{"quotas": list})
+	})
+
+	r.Get("/quotas/:name/consumers/:consumer", func(c fiber.Ctx) error {
+		return quotaUsage(c, quotas, func(p quota.Policy, consumer string) (quota.Usage, error) {
+			return quotas.Usage(c.Context(), p, consumer, time.Now())
+		})
+	})
+
+	r.Post("/quotas/:name/consumers/:consumer/reset", func(c fiber.Ctx) error {
+		return quotaUsage(c, quotas, func(p quota.Policy, consumer string) (quota.Usage, error) {
+			u, err := quotas.Reset(c.Context(), p, consumer, time.Now())
+			if err == nil {
+				middleware.Log(c).Info("Quota usage reset", map[string]interface{}{"quota": p.Name, "consumer": consumer})
+			}
+			return u, err
+		})
+	})
+
+	r.Post("/quotas/:name/consumers/:consumer/top-up", func(c fiber.Ctx) error {
+		var body struct {
+			Amount int64 `json:"amount"`
+		}
+		if err := c.Bind().JSON(&body); err != nil || body.Amount <= 0 {
+			return middleware.ErrorJSON(c, fiber.StatusBadRequest, "Body must be {\"amount\": <positive integer>}")
+		}
+		return quotaUsage(c, quotas, func(p quota.Policy, consumer string) (quota.Usage, error) {
+			u, err := quotas.TopUp(c.Context(), p, consumer, body.Amount, time.Now())
+			if err == nil {
+				middleware.Log(c).Info("Quota topped up", map[string]interface{}{"quota": p.Name, "consumer": consumer, "amount": body.Amount})
+			}
+			return u, err
+		})
+	})
+
+	if plans != nil {
+		registerPlanAdmin(r, plans)
+	}
+}
+
+func registerPlanAdmin(r fiber.Router, plans *ratelimit.Plans) {
+	r.Get("/ratelimit/plans", func(c fiber.Ctx) error {
+		list := make([]fiber.Map, 0, len(plans.Names()))
+		for _, name := range plans.Names() {
+			limits, _ := plans.Limits(name)
+			policies := make([]string, 0, len(limits))
+			for _, l := range limits {
+				policies = append(policies, l.Policy())
+			}
+			list = append(list, fiber.Map{"name": name, "limits": policies})
+		}
+		return c.JSON(fiber.Map{"plans": list, "default": plans.Default()})
+	})
+
+	r.Get("/ratelimit/consumers/:consumer/plan", func(c fiber.Ctx) error {
+		return consumerPlan(c, plans)
+	})
+
+	r.Put("/ratelimit/consumers/:consumer/plan", func(c fiber.Ctx) error {
+		var body struct {
+			Plan string `json:"plan"`
+		}
+		if err := c.Bind().JSON(&body); err != nil || body.Plan == "" {
+			return middleware.ErrorJSON(c, fiber.StatusBadRequest, "Body must be {\"plan\": \"<name>\"}")
+		}
+		err := plans.Assign(c.Context(), c.Params("consumer"), body.Plan)
+		if errors.Is(err, ratelimit.ErrUnknownPlan) {
+			return middleware.ErrorJSON(c, fiber.StatusBadRequest, "Unknown plan")
+		}
+		if err != nil {
+			middleware.Log(c).Error("Rate limit plan store error", err, nil)
+			return middleware.ErrorJSON(c, fiber.StatusBadGateway, "Plan store unavailable")
+		}
+
+		middleware.Log(c).Info("Rate limit plan assigned", map[string]interface{}{"consumer": c.Params("consumer"), "plan": body.Plan})
+		return consumerPlan(c, plans)
+	})
+
+	r.Delete("/ratelimit/consumers/:consumer/plan", func(c fiber.Ctx) error {
+		if err := plans.Unassign(c.Context(), c.Params("consumer")); err != nil {
+			middleware.Log(c).Error("Rate limit plan store error", err, nil)
+			return middleware.ErrorJSON(c, fiber.StatusBadGateway, "Plan store unavailable")
+		}
+
+		middleware.Log(c).Info("Rate limit plan unassigned", map[string]interface{}{"consumer": c.Params("consumer")})
+		return consumerPlan(c, plans)
+	})
+}
+
+// consumerPlan answers with the plan assigned to a consumer and the plan in
+// effect.
+func consumerPlan(c fiber.Ctx, plans *ratelimit.Plans) error {
+	consumer := c.Params("consumer")
+	assigned, err := plans.Assigned(c.Context(), consumer)
+	if err != nil {
+		middleware.Log(c).Error("Rate limit plan store error", err, nil)
+		return middleware.ErrorJSON(c, fiber.StatusBadGateway, "Plan store unavailable")
+	}
+	effective := assigned
+	if _, ok := plans.Limits(assigned); !ok {
+		effective = plans.Default()
+	}
+	return c.JSON(fiber.Map{"consumer": consumer, "assigned": assigned, "plan": effective})
+}
+
+// quotaUsage resolves the quota and consumer of a quota admin request and
+// answers with the usage op returns.
+func quotaUsage(c fiber.Ctx, quotas *quota.Manager, op func(p quota.Policy, consumer string) (quota.Usage, error)) error {
+	p, ok := quotas.Policy(c.Params("name"))
+	if !ok {
+		return middleware.ErrorJSON(c, fiber.StatusNotFound, "Quota not found")
+	}
+	u, err := op(p, c.Params("consumer"))
+	if err != nil {
+		middleware.Log(c).Error("Quota store error", err, nil)
+		return middleware.ErrorJSON(c, fiber.StatusBadGateway, "Quota store unavailable")
+	}
+	return c.JSON(u)
+}
+
+func maintenanceStatus(scope string, m *middleware.Maintenance) fiber.Map {
+	return fiber.Map{"scope": scope, "enabled": m.Enabled(), "maintenance": m.Config()}
+}
+
+func toggleMaintenance(c fiber.Ctx, scope string, m *middleware.Maintenance) error {
+	var body struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := c.Bind().JSON(&body); err != nil || body.Enabled == nil {
+		return middleware.ErrorJSON(c, fiber.StatusBadRequest, "Body must be {\"enabled\": true|false}")
+	}
+	m.SetEnabled(*body.Enabled)
+	return c.JSON(maintenanceStatus(scope, m))
+}
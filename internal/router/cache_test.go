@@ -0,0 +1,83 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"vibeway/internal/config"
+)
+
+// cachedUpstream answers with a cacheable response naming itself and counts
+// the requests it gets.
+func cachedUpstream(t *testing.T, name string, hits *atomic.Int32) config.UpstreamConfig {
+	return newTestUpstream(t, name, func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"`+name+`-v1"`)
+		w.Header().Set("X-Upstream", name)
+		w.Write([]byte(name + " " + r.URL.RawQuery))
+	})
+}
+
+func TestResponseCache(t *testing.T) {
+	var stableHits, betaHits atomic.Int32
+	app := newTestGateway(t, config.Config{
+		Upstreams: map[string]config.UpstreamConfig{
+			"stable": cachedUpstream(t, "stable", &stableHits),
+			"beta":   cachedUpstream(t, "beta", &betaHits),
+		},
+		Routes: []config.RouteConfig{{
+			Path:     "/catalog/*",
+			Methods:  []string{"GET", "HEAD"},
+			Upstream: "stable",
+			Rules:    []config.MatchRuleConfig{{Upstream: "beta", When: []string{"header.X-Beta exists"}}},
+			Cache: config.CacheConfig{
+				Enabled: true,
+				Key:     config.CacheKeyConfig{QueryParams: []string{"page"}},
+			},
+		}},
+	})
+
+	get := func(target string, header ...string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		return do(t, app, req)
+	}
+	expect := func(resp *http.Response, status int, xCache, upstream string) {
+		t.Helper()
+		if resp.StatusCode != status || resp.Header.Get("X-Cache") != xCache || resp.Header.Get("X-Upstream") != upstream {
+			t.Errorf("got %d, X-Cache %q from %q; want %d, %q from %q",
+				resp.StatusCode, resp.Header.Get("X-Cache"), resp.Header.Get("X-Upstream"), status, xCache, upstream)
+		}
+	}
+
+	expect(get("/catalog/items?page=1"), http.StatusOK, "MISS", "stable")
+	expect(get("/catalog/items?page=1"), http.StatusOK, "HIT", "stable")
+	// Query params outside the key share the entry
+	expect(get("/catalog/items?page=1&utm_source=mail"), http.StatusOK, "HIT", "stable")
+	expect(get("/catalog/items?page=2"), http.StatusOK, "MISS", "stable")
+	if n := stableHits.Load(); n != 2 {
+		t.Errorf("stable upstream called %d times, want 2", n)
+	}
+
+	// A conditional request matching the cached ETag is answered by the gateway
+	expect(get("/catalog/items?page=1", "If-None-Match", `"stable-v1"`), http.StatusNotModified, "HIT", "stable")
+
+	// The same URL routed to another upstream is another entry
+	expect(get("/catalog/items?page=1", "X-Beta", "1"), http.StatusOK, "MISS", "beta")
+	expect(get("/catalog/items?page=1", "X-Beta", "1"), http.StatusOK, "HIT", "beta")
+	expect(get("/catalog/items?page=1"), http.StatusOK, "HIT", "stable")
+	if n := betaHits.Load(); n != 1 {
+		t.Errorf("beta upstream called %d times, want 1", n)
+	}
+
+	// Clients can opt out of the cache
+	expect(get("/catalog/items?page=1", "Cache-Control", "no-store"), http.StatusOK, "BYPASS", "stable")
+	if n := stableHits.Load(); n != 3 {
+		t.Errorf("stable upstream called %d times, want 3", n)
+	}
+}
@@ -0,0 +1,95 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"vibeway/internal/config"
+)
+
+func TestCoalescing(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	backend := newTestUpstream(t, "reports", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "private")
+		}
+		w.Write([]byte("report for " + r.Header.Get("Authorization")))
+	})
+	app := newTestGateway(t, config.Config{
+		Upstreams: map[string]config.UpstreamConfig{"reports": backend},
+		Routes: []config.RouteConfig{{
+			Path:     "/reports/*",
+			Methods:  []string{"GET"},
+			Upstream: "reports",
+			Coalesce: config.CoalesceConfig{Enabled: true},
+		}},
+	})
+
+	// burst sends concurrent GETs, one per token, and returns their bodies
+	// once the upstream has been held long enough for all of them to arrive.
+	burst := func(path string, tokens ...string) []string {
+		t.Helper()
+		calls.Store(0)
+		release = make(chan struct{})
+		bodies := make([]string, len(tokens))
+		var wg sync.WaitGroup
+		for i, token := range tokens {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				req.Header.Set("Authorization", token)
+				resp, err := app.Test(req)
+				if err != nil {
+					t.Errorf("request %d: %v", i, err)
+					return
+				}
+				defer resp.Body.Close()
+				body, _ := io.ReadAll(resp.Body)
+				bodies[i] = string(body)
+			}()
+		}
+		time.Sleep(200 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		return bodies
+	}
+	same := func(n int, token string) []string {
+		tokens := make([]string, n)
+		for i := range tokens {
+			tokens[i] = token
+		}
+		return tokens
+	}
+
+	for i, body := range burst("/reports/daily", same(8, "alice")...) {
+		if body != "report for alice" {
+			t.Errorf("waiter %d got %q", i, body)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("identical requests made %d upstream calls, want 1", n)
+	}
+
+	bodies := burst("/reports/daily", "alice", "bob")
+	if n := calls.Load(); n != 2 {
+		t.Errorf("requests of two identities made %d upstream calls, want 2", n)
+	}
+	if bodies[0] != "report for alice" || bodies[1] != "report for bob" {
+		t.Errorf("identities got %q, one shared the other's response", bodies)
+	}
+
+	// Followers of a private response fetch on their own after the leader
+	burst("/reports/private", same(4, "alice")...)
+	if n := calls.Load(); n != 4 {
+		t.Errorf("private response: %d upstream calls, want 4", n)
+	}
+}
@@ -0,0 +1,366 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"vibeway/internal/config"
+	"vibeway/internal/middleware"
+	"vibeway/internal/proxy"
+	"vibeway/internal/tracing"
+	"vibeway/internal/transform"
+	"vibeway/internal/upstream"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const routeTypeCompose = "compose"
+
+const (
+	composeOnErrorPartial = "partial"
+	composeOnErrorFail    = "fail"
+)
+
+// Composer is the terminal handler of a composition route: it runs the
+// configured sub-calls, each as soon as the calls it references are done,
+// and merges their JSON responses through the response template.
+type Composer struct {
+	route           string
+	calls           []composeCall
+	response        *transform.Template
+	failFast        bool
+	requestIDHeader string
+
+	client    *proxy.ProxyClient
+	upstreams *upstream.Manager
+}
+
+type composeCall struct {
+	name     string
+	upstream string
+	method   string
+	path     *transform.Template
+	body     *transform.Template
+	headers  []headerTemplate
+	forward  []string
+	timeout  time.Duration
+	deps     []int
+}
+
+type composeResult struct {
+	value interface{}
+	err   error
+}
+
+func NewComposer(route string, cfg config.ComposeConfig, client *proxy.ProxyClient, upstreams *upstream.Manager, requestIDHeader string) (*Composer, error) {
+	if len(cfg.Calls) == 0 {
+		return nil, errors.New("compose route needs at least one call")
+	}
+
+	cp := &Composer{
+		route:           route,
+		requestIDHeader: requestIDHeader,
+		client:          client,
+		upstreams:       upstreams,
+	}
+
+	switch cfg.OnError {
+	case "", composeOnErrorPartial:
+	case composeOnErrorFail:
+		cp.failFast = true
+	default:
+		return nil, fmt.Errorf("compose on_error must be partial or fail, got %q", cfg.OnError)
+	}
+
+	index := make(map[string]int, len(cfg.Calls))
+	for i, call := range cfg.Calls {
+		if call.Name == "" || call.Upstream == "" {
+			return nil, fmt.Errorf("compose call %d needs a name and an upstream", i)
+		}
+		if strings.Contains(call.Name, ".") {
+			return nil, fmt.Errorf("compose call name %q must not contain dots", call.Name)
+		}
+		if _, dup := index[call.Name]; dup {
+			return nil, fmt.Errorf("duplicate compose call %q", call.Name)
+		}
+		index[call.Name] = i
+	}
+
+	for _, call := range cfg.Calls {
+		timeoutMs := call.TimeoutMs
+		if timeoutMs == 0 {
+			timeoutMs = cfg.TimeoutMs
+		}
+		method := strings.ToUpper(call.Method)
+		if method == "" {
+			method = fiber.MethodGet
+		}
+
+		cc := composeCall{
+			name:     call.Name,
+			upstream: call.Upstream,
+			method:   method,
+			path:     transform.CompileTemplate(call.Path),
+			headers:  compileHeaders(call.Headers),
+			forward:  call.ForwardHeaders,
+			timeout:  time.Duration(timeoutMs) * time.Millisecond,
+		}
+		if call.Body != "" {
+			cc.body = transform.CompileTemplate(call.Body)
+		}
+
+		templates := []*transform.Template{cc.path}
+		if cc.body != nil {
+			templates = append(templates, cc.body)
+		}
+		for _, h := range cc.headers {
+			templates = append(templates, h.value)
+		}
+		seen := make(map[int]bool)
+		for _, t := range templates {
+			for _, name := range t.Names() {
+				ref, ok := strings.CutPrefix(name, "calls.")
+				if !ok {
+					continue
+				}
+				ref, _, _ = strings.Cut(ref, ".")
+				dep, ok := index[ref]
+				if !ok {
+					return nil, fmt.Errorf("compose call %q references unknown call %q", call.Name, ref)
+				}
+				if !seen[dep] {
+					seen[dep] = true
+					cc.deps = append(cc.deps, dep)
+				}
+			}
+		}
+		cp.calls = append(cp.calls, cc)
+	}
+
+	if err := cp.checkCycles(); err != nil {
+		return nil, err
+	}
+
+	response := cfg.Response
+	if response == "" {
+		response = defaultComposeResponse(cfg.Calls)
+	}
+	cp.response = transform.CompileTemplate(response)
+	if !json.Valid([]byte(cp.response.RenderJSON(&transform.Vars{}))) {
+		return nil, errors.New("compose response template is not valid JSON")
+	}
+	return cp, nil
+}
+
+// defaultComposeResponse nests every call's response under its name.
+func defaultComposeResponse(calls []config.ComposeCallConfig) string {
+	parts := make([]string, 0, len(calls))
+	for _, call := range calls {
+		key, _ := json.Marshal(call.Name)
+		parts = append(parts, fmt.Sprintf("%s: ${calls.%s}", key, call.Name))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+func (cp *Composer) checkCycles() error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(cp.calls))
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visiting:
+			return fmt.Errorf("compose call %q is part of a dependency cycle", cp.calls[i].name)
+		case visited:
+			return nil
+		}
+		state[i] = visiting
+		for _, dep := range cp.calls[i].deps {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[i] = visited
+		return nil
+	}
+
+	for i := range cp.calls {
+		if err := visit(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cp *Composer) Handle(c fiber.Ctx) error {
+	base := directVars(c, cp.route)
+	ctx := c.Context()
+
+	// The context is not safe for concurrent use, read headers up front
+	forwarded := make([]map[string]string, len(cp.calls))
+	for i, call := range cp.calls {
+		forwarded[i] = make(map[string]string, len(call.forward))
+		for _, name := range call.forward {
+			if v := c.Get(name); v != "" {
+				forwarded[i][name] = v
+			}
+		}
+	}
+
+	results := make([]composeResult, len(cp.calls))
+	done := make([]chan struct{}, len(cp.calls))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	for i := range cp.calls {
+		go func(i int) {
+			defer close(done[i])
+			call := &cp.calls[i]
+
+			vars := *base
+			vars.Responses = make(map[string]interface{}, len(call.deps))
+			for _, dep := range call.deps {
+				<-done[dep]
+				if results[dep].err != nil {
+					results[i].err = fmt.Errorf("dependency %q failed", cp.calls[dep].name)
+					return
+				}
+				vars.Responses[cp.calls[dep].name] = results[dep].value
+			}
+
+			results[i].value, results[i].err = cp.do(ctx, call, &vars, forwarded[i])
+		}(i)
+	}
+
+	var failed []string
+	responses := make(map[string]interface{}, len(cp.calls))
+	for i, call := range cp.calls {
+		<-done[i]
+		if err := results[i].err; err != nil {
+			failed = append(failed, call.name)
+			middleware.Log(c).Warn("Composition call failed", map[string]interface{}{
+				"route": cp.route,
+				"call":  call.name,
+				"error": err.Error(),
+			})
+			continue
+		}
+		responses[call.name] = results[i].value
+	}
+	// Calls copy base when they start, set only once all are done
+	base.Responses = responses
+
+	if len(failed) > 0 {
+		if cp.failFast {
+			return middleware.ErrorJSON(c, fiber.StatusBadGateway, fmt.Sprintf("Composition call %q failed", failed[0]))
+		}
+		c.Set("X-Compose-Failed", strings.Join(failed, ","))
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.SendString(cp.response.RenderJSON(base))
+}
+
+// do runs one sub-call in its own client span and decodes its JSON response.
+func (cp *Composer) do(ctx context.Context, call *composeCall, vars *transform.Vars, forwarded map[string]string) (interface{}, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "compose "+call.name, trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("compose.route", cp.route),
+		attribute.String("compose.call", call.name),
+		attribute.String("upstream", call.upstream),
+		attribute.String("http.method", call.method),
+	)
+
+	value, status, err := cp.exchange(ctx, call, vars, forwarded)
+	if status != 0 {
+		span.SetAttributes(attribute.Int("http.status_code", status))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return value, err
+}
+
+func (cp *Composer) exchange(ctx context.Context, call *composeCall, vars *transform.Vars, forwarded map[string]string) (interface{}, int, error) {
+	u, ok := cp.upstreams.GetUpstream(call.upstream)
+	if !ok {
+		return nil, 0, fmt.Errorf("upstream %q not found", call.upstream)
+	}
+	targetURL, ok := u.GetNextURL()
+	if !ok {
+		return nil, 0, fmt.Errorf("no healthy upstream available for %q", call.upstream)
+	}
+
+	u.IncConnection(targetURL)
+	defer u.DecConnection(targetURL)
+
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.Header.SetMethod(call.method)
+	for name, v := range forwarded {
+		req.Header.Set(name, v)
+	}
+	for _, h := range call.headers {
+		req.Header.Set(h.name, h.value.Render(vars))
+	}
+	if call.body != nil {
+		req.SetBodyString(call.body.Render(vars))
+		if len(req.Header.ContentType()) == 0 {
+			req.Header.SetContentType(fiber.MIMEApplicationJSON)
+		}
+	}
+	if vars.RequestID != "" {
+		req.Header.Set(cp.requestIDHeader, vars.RequestID)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, tracing.HeaderCarrier{Header: &req.Header})
+
+	path := call.path.RenderURL(vars)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	if err := cp.client.DoTimeout(req, resp, targetURL+path, call.timeout); err != nil {
+		return nil, 0, err
+	}
+
+	status := resp.StatusCode()
+	if status >= fiber.StatusBadRequest {
+		return nil, status, fmt.Errorf("upstream answered %d", status)
+	}
+
+	body, err := resp.BodyUncompressed()
+	if err != nil {
+		return nil, status, fmt.Errorf("failed to decode response body: %w", err)
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, status, nil
+	}
+
+	var value interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return nil, status, fmt.Errorf("response is not JSON: %w", err)
+	}
+	return value, status, nil
+}
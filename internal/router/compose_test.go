@@ -0,0 +1,88 @@
+package router
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"vibeway/internal/config"
+)
+
+func TestComposition(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/42", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0ken" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"id": 42, "name": "Ada", "customer_id": "c 9"}`))
+	})
+	mux.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {
+		// The customer ID from the first call arrives URL-escaped
+		if r.URL.Query().Get("customer") != "c 9" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"items": [{"id": "o1"}, {"id": "o2"}]}`))
+	})
+	mux.HandleFunc("/users/42/preferences", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(`{"theme": "dark"}`))
+	})
+
+	compose := func(onError string) config.ComposeConfig {
+		return config.ComposeConfig{
+			OnError:  onError,
+			Response: `{"user": ${calls.user.name}, "orders": ${calls.orders.items}, "theme": ${calls.prefs.theme}}`,
+			Calls: []config.ComposeCallConfig{
+				{Name: "user", Upstream: "users", Path: "/users/${path.id}", ForwardHeaders: []string{"Authorization"}},
+				{Name: "orders", Upstream: "users", Path: "/orders?customer=${calls.user.customer_id}"},
+				{Name: "prefs", Upstream: "users", Path: "/users/${path.id}/preferences", TimeoutMs: 50},
+			},
+		}
+	}
+	app := newTestGateway(t, config.Config{
+		Upstreams: map[string]config.UpstreamConfig{"users": newTestUpstream(t, "users", mux.ServeHTTP)},
+		Routes: []config.RouteConfig{
+			{Path: "/screens/home/:id", Type: "compose", Methods: []string{"GET"}, Compose: compose("partial")},
+			{Path: "/strict/home/:id", Type: "compose", Methods: []string{"GET"}, Compose: compose("fail")},
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/screens/home/42", nil)
+	req.Header.Set("Authorization", "Bearer t0ken")
+	resp := do(t, app, req)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200 with partial results", resp.StatusCode)
+	}
+	if got := resp.Header.Get("X-Compose-Failed"); got != "prefs" {
+		t.Errorf("X-Compose-Failed %q, want the timed out prefs call", got)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	var got, want interface{}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("response is not JSON: %s", body)
+	}
+	json.Unmarshal([]byte(`{"user": "Ada", "orders": [{"id": "o1"}, {"id": "o2"}], "theme": null}`), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged response %s", body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/strict/home/42", nil)
+	req.Header.Set("Authorization", "Bearer t0ken")
+	if resp := do(t, app, req); resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("on_error fail: status %d, want 502", resp.StatusCode)
+	}
+
+	// Without the forwarded token the first call fails and its dependant
+	// never runs
+	resp = do(t, app, httptest.NewRequest(http.MethodGet, "/screens/home/42", nil))
+	if got := resp.Header.Get("X-Compose-Failed"); got != "user,orders,prefs" {
+		t.Errorf("X-Compose-Failed %q, want user,orders,prefs", got)
+	}
+}
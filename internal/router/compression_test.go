@@ -0,0 +1,144 @@
+package router
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"vibeway/internal/config"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestResponseCompression(t *testing.T) {
+	doc := []byte(`{"items": [` + strings.Repeat(`{"name": "widget", "price": 10},`, 100) + `{}]}`)
+	precompressed := gzipped(t, doc)
+
+	backend := newTestUpstream(t, "assets", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/small":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"ok": true}`))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(doc)
+		case "/encoded":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(precompressed)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(doc)
+		}
+	})
+	app := newTestGateway(t, config.Config{
+		Upstreams: map[string]config.UpstreamConfig{"assets": backend},
+		Routes: []config.RouteConfig{{
+			Path:        "/assets/*",
+			Methods:     []string{"GET"},
+			Upstream:    "assets",
+			Compression: config.CompressionConfig{Enabled: true},
+		}},
+	})
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"br":   func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		"zstd": func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+		"":     func(r io.Reader) (io.Reader, error) { return r, nil },
+	}
+
+	check := func(path, acceptEncoding, wantEncoding string, want []byte) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		resp := do(t, app, req)
+
+		encoding := resp.Header.Get("Content-Encoding")
+		if encoding != wantEncoding {
+			t.Errorf("%s with %q: Content-Encoding %q, want %q", path, acceptEncoding, encoding, wantEncoding)
+			return
+		}
+		r, err := decoders[encoding](resp.Body)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		body, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(body, want) {
+			t.Errorf("%s with %q: body does not decode to the upstream's (%v)", path, acceptEncoding, err)
+		}
+	}
+
+	check("/assets/doc", "gzip", "gzip", doc)
+	check("/assets/doc", "gzip, br", "br", doc)
+	check("/assets/doc", "zstd;q=1, gzip;q=0.5", "zstd", doc)
+	check("/assets/doc", "identity", "", doc)
+	check("/assets/small", "gzip", "", []byte(`{"ok": true}`))
+	check("/assets/image", "gzip", "", doc)
+	// Already encoded by the upstream: passed through byte for byte
+	check("/assets/encoded", "gzip, br", "gzip", doc)
+
+	req := httptest.NewRequest(http.MethodGet, "/assets/doc", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	if vary := do(t, app, req).Header.Get("Vary"); !strings.Contains(vary, "Accept-Encoding") {
+		t.Errorf("Vary %q, want Accept-Encoding", vary)
+	}
+}
+
+func TestRequestDecompression(t *testing.T) {
+	var received []byte
+	var receivedEncoding string
+	backend := newTestUpstream(t, "ingest", func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		receivedEncoding = r.Header.Get("Content-Encoding")
+	})
+	app := newTestGateway(t, config.Config{
+		Upstreams: map[string]config.UpstreamConfig{"ingest": backend},
+		Routes: []config.RouteConfig{{
+			Path:                 "/ingest/*",
+			Methods:              []string{"POST"},
+			Upstream:             "ingest",
+			RequestDecompression: config.RequestDecompressionConfig{Enabled: true, MaxBytes: 1 << 10},
+		}},
+	})
+
+	post := func(body []byte) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, "/ingest/events", bytes.NewReader(body))
+		req.Header.Set("Content-Encoding", "gzip")
+		return do(t, app, req)
+	}
+
+	events := []byte(`[{"event": "click"}]`)
+	if resp := post(gzipped(t, events)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200", resp.StatusCode)
+	}
+	if !bytes.Equal(received, events) || receivedEncoding != "" {
+		t.Errorf("upstream got %q with Content-Encoding %q, want the decoded body", received, receivedEncoding)
+	}
+
+	// About 1 KiB that decodes to 1 MiB
+	received = nil
+	bomb := gzipped(t, bytes.Repeat([]byte{'a'}, 1<<20))
+	if resp := post(bomb); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("bomb: status %d, want 413", resp.StatusCode)
+	}
+	if received != nil {
+		t.Error("bomb reached the upstream")
+	}
+}
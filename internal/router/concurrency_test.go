@@ -0,0 +1,125 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"vibeway/internal/config"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// slowBackend holds each request for /slow until a value is sent on release,
+// signalling entered when one arrives, and answers everything else right
+// away with a cacheable response.
+func slowBackend(t *testing.T) (u config.UpstreamConfig, entered, release chan struct{}) {
+	t.Helper()
+	entered, release = make(chan struct{}, 8), make(chan struct{})
+	u = newTestUpstream(t, "reports", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			entered <- struct{}{}
+			<-release
+		}
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.URL.Path))
+	})
+	// Cleanups run last in first out: free the handlers before their server closes
+	t.Cleanup(func() { close(release) })
+	return u, entered, release
+}
+
+// inBackground sends a request without waiting for its response.
+func inBackground(app *fiber.App, path string) <-chan int {
+	status := make(chan int, 1)
+	go func() {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil), fiber.TestConfig{Timeout: 10 * time.Second})
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	return status
+}
+
+func TestUpstreamConcurrencyCacheHits(t *testing.T) {
+	reports, entered, release := slowBackend(t)
+	reports.Concurrency = config.ConcurrencyConfig{Limit: 1, RejectStatus: http.StatusTooManyRequests}
+	app := newTestGateway(t, config.Config{
+		Upstreams: map[string]config.UpstreamConfig{"reports": reports},
+		Routes: []config.RouteConfig{{
+			Path:     "/reports/*",
+			Methods:  []string{"GET"},
+			Upstream: "reports",
+			Cache:    config.CacheConfig{Enabled: true},
+		}},
+	})
+	get := func(path string) *http.Response {
+		return do(t, app, httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if resp := get("/reports/daily"); resp.Header.Get("X-Cache") != "MISS" {
+		t.Fatalf("first request: X-Cache %q, want MISS", resp.Header.Get("X-Cache"))
+	}
+
+	// The slow request holds the upstream's only slot
+	slow := inBackground(app, "/reports/slow")
+	<-entered
+
+	if resp := get("/reports/daily"); resp.StatusCode != http.StatusOK || resp.Header.Get("X-Cache") != "HIT" {
+		t.Errorf("cached request: status %d, X-Cache %q; want a 200 HIT", resp.StatusCode, resp.Header.Get("X-Cache"))
+	}
+	resp := get("/reports/weekly")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("uncached request: status %d, Retry-After %q; want 429 with Retry-After", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	release <- struct{}{}
+	if status := <-slow; status != http.StatusOK {
+		t.Errorf("slow request: status %d, want 200", status)
+	}
+	if resp := get("/reports/weekly"); resp.StatusCode != http.StatusOK {
+		t.Errorf("after the slot freed: status %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestRouteConcurrencyQueue(t *testing.T) {
+	reports, entered, release := slowBackend(t)
+	app := newTestGateway(t, config.Config{
+		Upstreams: map[string]config.UpstreamConfig{"reports": reports},
+		Routes: []config.RouteConfig{{
+			Path:        "/reports/*",
+			Methods:     []string{"GET"},
+			Upstream:    "reports",
+			Concurrency: config.ConcurrencyConfig{Limit: 1, QueueSize: 1, QueueTimeoutMs: 200},
+		}},
+	})
+
+	first := inBackground(app, "/reports/slow")
+	<-entered
+
+	// Nothing frees the slot, so the queued request times out
+	start := time.Now()
+	resp := do(t, app, httptest.NewRequest(http.MethodGet, "/reports/daily", nil))
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("queued request: status %d, Retry-After %q; want 503 with Retry-After", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if waited := time.Since(start); waited < 200*time.Millisecond {
+		t.Errorf("queued request rejected after %v, want it to wait out the queue timeout", waited)
+	}
+
+	// A queued request takes the slot once it frees up
+	second := inBackground(app, "/reports/slow")
+	release <- struct{}{}
+	if status := <-first; status != http.StatusOK {
+		t.Errorf("first request: status %d, want 200", status)
+	}
+	<-entered
+	release <- struct{}{}
+	if status := <-second; status != http.StatusOK {
+		t.Errorf("second request: status %d, want 200", status)
+	}
+}
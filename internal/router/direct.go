@@ -0,0 +1,210 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"vibeway/internal/config"
+	"vibeway/internal/middleware"
+	"vibeway/internal/transform"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Route types. Everything other than proxy answers without an upstream.
+const (
+	routeTypeProxy    = "proxy"
+	routeTypeStatic   = "static"
+	routeTypeRedirect = "redirect"
+	routeTypeMock     = "mock"
+)
+
+type headerTemplate struct {
+	name  string
+	value *transform.Template
+}
+
+// directHandler builds the terminal handler for static, redirect and mock
+// routes. Bodies and files are loaded once at startup.
+func directHandler(rCfg config.RouteConfig) (fiber.Handler, error) {
+	switch rCfg.Type {
+	case routeTypeStatic:
+		return staticHandler(rCfg)
+	case routeTypeRedirect:
+		return redirectHandler(rCfg)
+	case routeTypeMock:
+		return mockHandler(rCfg)
+	}
+	return nil, fmt.Errorf("unknown route type %q", rCfg.Type)
+}
+
+func staticHandler(rCfg config.RouteConfig) (fiber.Handler, error) {
+	cfg := rCfg.Static
+	body := []byte(cfg.Body)
+	contentType := cfg.ContentType
+
+	if cfg.File != "" {
+		data, err := os.ReadFile(cfg.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read static file: %w", err)
+		}
+		body = data
+		if contentType == "" {
+			contentType = mime.TypeByExtension(filepath.Ext(cfg.File))
+		}
+	}
+	if contentType == "" {
+		contentType = fiber.MIMETextPlainCharsetUTF8
+	}
+
+	return fixedResponse(rCfg.RouteName(), cfg.Status, contentType, body, cfg.Headers), nil
+}
+
+func mockHandler(rCfg config.RouteConfig) (fiber.Handler, error) {
+	cfg := rCfg.Mock
+	var body []byte
+	if cfg.Body != "" {
+		if !json.Valid([]byte(cfg.Body)) {
+			return nil, fmt.Errorf("mock body is not valid JSON")
+		}
+		body = []byte(cfg.Body)
+	} else {
+		var err error
+		if body, err = json.Marshal(cfg.JSON); err != nil {
+			return nil, fmt.Errorf("invalid mock JSON: %w", err)
+		}
+	}
+	return fixedResponse(rCfg.RouteName(), cfg.Status, fiber.MIMEApplicationJSON, body, cfg.Headers), nil
+}
+
+func fixedResponse(route string, status int, contentType string, body []byte, headers map[string]string) fiber.Handler {
+	if status == 0 {
+		status = fiber.StatusOK
+	}
+	compiled := compileHeaders(headers)
+
+	return func(c fiber.Ctx) error {
+		if len(compiled) > 0 {
+			vars := directVars(c, route)
+			for _, h := range compiled {
+				c.Set(h.name, h.value.Render(vars))
+			}
+		}
+		c.Set(fiber.HeaderContentType, contentType)
+		return c.Status(status).Send(body)
+	}
+}
+
+func redirectHandler(rCfg config.RouteConfig) (fiber.Handler, error) {
+	cfg := rCfg.Redirect
+	if cfg.Location == "" {
+		return nil, fmt.Errorf("redirect route needs a location")
+	}
+
+	status := cfg.Status
+	switch status {
+	case 0:
+		status = fiber.StatusFound
+	case fiber.StatusMovedPermanently, fiber.StatusFound, fiber.StatusTemporaryRedirect, fiber.StatusPermanentRedirect:
+	default:
+		return nil, fmt.Errorf("redirect status must be 301, 302, 307 or 308, got %d", status)
+	}
+
+	location := transform.CompileTemplate(cfg.Location)
+	compiled := compileHeaders(cfg.Headers)
+
+	// The scheme of an absolute location, "" for a relative one
+	scheme, _, found := strings.Cut(cfg.Location, "://")
+	if !found || strings.ContainsAny(scheme, "/$?#") {
+		scheme = ""
+	}
+
+	return func(c fiber.Ctx) error {
+		vars := directVars(c, rCfg.RouteName())
+		// "...?${query}" without a query string leaves a dangling "?"
+		target := strings.TrimSuffix(location.RenderURL(vars), "?")
+		if !safeRedirect(target, scheme) {
+			middleware.Log(c).Warn("Redirect location rejected", map[string]interface{}{
+				"route":    rCfg.RouteName(),
+				"location": target,
+			})
+			return middleware.ErrorJSON(c, fiber.StatusBadRequest, "Invalid redirect location")
+		}
+
+		for _, h := range compiled {
+			c.Set(h.name, h.value.Render(vars))
+		}
+		c.Set(fiber.HeaderLocation, target)
+		return c.SendStatus(status)
+	}, nil
+}
+
+// safeRedirect reports whether a rendered location still points where its
+// template did: captures must not turn a relative location into a
+// protocol-relative or absolute one, or change an absolute one's scheme.
+func safeRedirect(location, scheme string) bool {
+	if strings.HasPrefix(location, "//") || strings.HasPrefix(location, `/\`) {
+		return false
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return false
+	}
+	if scheme == "" {
+		return u.Scheme == "" && u.Host == ""
+	}
+	return strings.EqualFold(u.Scheme, scheme)
+}
+
+func compileHeaders(headers map[string]string) []headerTemplate {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	compiled := make([]headerTemplate, 0, len(names))
+	for _, name := range names {
+		compiled = append(compiled, headerTemplate{name: name, value: transform.CompileTemplate(headers[name])})
+	}
+	return compiled
+}
+
+// directVars exposes decoded path captures (${path.id}, ${path.*}), the
+// query string and the usual request values to direct-response templates.
+func directVars(c fiber.Ctx, route string) *transform.Vars {
+	vars := &transform.Vars{
+		ClientIP:  c.IP(),
+		RequestID: middleware.GetRequestID(c),
+		Route:     route,
+		Query:     string(c.Request().URI().QueryString()),
+		Params:    make(map[string]string),
+	}
+	vars.Claims, _ = c.Locals("claims").(jwt.MapClaims)
+
+	for _, name := range c.Route().Params {
+		// Captures are decoded here and escaped again by RenderURL
+		value := c.Params(name)
+		if decoded, err := url.PathUnescape(value); err == nil {
+			value = decoded
+		}
+		vars.Params[name] = value
+		// Wildcards are named *1, *2, ...; ${path.*} means the first one
+		if name == "*1" {
+			vars.Params["*"] = value
+		}
+	}
+	return vars
+}
+
+// isDirect reports whether a route answers without an upstream.
+func isDirect(rCfg config.RouteConfig) bool {
+	return rCfg.Type != "" && !strings.EqualFold(rCfg.Type, routeTypeProxy)
+}
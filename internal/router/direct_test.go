@@ -0,0 +1,103 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"vibeway/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestDirectResponses(t *testing.T) {
+	dir := t.TempDir()
+	healthFile := filepath.Join(dir, "health.json")
+	if err := os.WriteFile(healthFile, []byte(`{"status":"ok"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestGateway(t, config.Config{
+		Security: config.SecurityConfig{JWT: testJWT},
+		Routes: []config.RouteConfig{
+			{
+				Path:    "/legacy/export",
+				Type:    "static",
+				Methods: []string{"GET"},
+				Static: config.StaticResponseConfig{
+					Status:  http.StatusGone,
+					Body:    "This endpoint was removed, use /api/v2/export",
+					Headers: map[string]string{"Sunset": "Sat, 01 Nov 2025 00:00:00 GMT"},
+				},
+			},
+			{
+				Path:    "/healthz",
+				Type:    "static",
+				Methods: []string{"GET"},
+				Static:  config.StaticResponseConfig{File: healthFile},
+			},
+			{
+				Path:     "/old/users/:id",
+				Type:     "redirect",
+				Methods:  []string{"GET"},
+				Redirect: config.RedirectConfig{Status: http.StatusPermanentRedirect, Location: "/api/v2/users/${path.id}?${query}"},
+			},
+			{
+				Path:        "/mock/profile",
+				Type:        "mock",
+				Methods:     []string{"GET"},
+				Middlewares: []string{"jwt"},
+				Mock:        config.MockConfig{Body: `{"id":"u1","displayName":"Ada"}`},
+			},
+		},
+	})
+
+	t.Run("static body", func(t *testing.T) {
+		resp := do(t, app, httptest.NewRequest(http.MethodGet, "/legacy/export", nil))
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusGone || resp.Header.Get("Sunset") == "" {
+			t.Errorf("status %d, Sunset %q; want 410 with the header", resp.StatusCode, resp.Header.Get("Sunset"))
+		}
+		if string(body) != "This endpoint was removed, use /api/v2/export" {
+			t.Errorf("body %q", body)
+		}
+	})
+
+	t.Run("static file", func(t *testing.T) {
+		resp := do(t, app, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || string(body) != `{"status":"ok"}` {
+			t.Errorf("got %d %s", resp.StatusCode, body)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type %q, want it from the file extension", ct)
+		}
+	})
+
+	t.Run("redirect with captures", func(t *testing.T) {
+		resp := do(t, app, httptest.NewRequest(http.MethodGet, "/old/users/a%20b?tab=orders", nil))
+		if resp.StatusCode != http.StatusPermanentRedirect {
+			t.Fatalf("status %d, want 308", resp.StatusCode)
+		}
+		if loc := resp.Header.Get("Location"); loc != "/api/v2/users/a%20b?tab=orders" {
+			t.Errorf("Location %q", loc)
+		}
+	})
+
+	t.Run("mock runs the middleware chain", func(t *testing.T) {
+		if resp := do(t, app, httptest.NewRequest(http.MethodGet, "/mock/profile", nil)); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("without a token: status %d, want 401", resp.StatusCode)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/mock/profile", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken(t, jwt.MapClaims{"sub": "u1"}))
+		resp := do(t, app, req)
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || string(body) != `{"id":"u1","displayName":"Ada"}` {
+			t.Errorf("got %d %s", resp.StatusCode, body)
+		}
+	})
+}
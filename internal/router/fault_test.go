@@ -0,0 +1,81 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"vibeway/internal/config"
+)
+
+func TestFaultInjection(t *testing.T) {
+	app := newTestGateway(t, config.Config{
+		Admin:     testAdmin,
+		Upstreams: map[string]config.UpstreamConfig{"orders": newTestUpstream(t, "orders", nil)},
+		Routes: []config.RouteConfig{
+			{
+				Name:     "abort",
+				Path:     "/abort/*",
+				Methods:  []string{"GET"},
+				Upstream: "orders",
+				Fault: config.FaultConfig{
+					Header:      "X-Chaos",
+					HeaderValue: "on",
+					Abort:       config.FaultAbortConfig{Percentage: 100, Status: http.StatusTeapot},
+				},
+			},
+			{
+				Name:     "delay",
+				Path:     "/delay/*",
+				Methods:  []string{"GET"},
+				Upstream: "orders",
+				Fault: config.FaultConfig{
+					Enabled: true,
+					Delay:   config.FaultDelayConfig{Percentage: 100, FixedMs: 50},
+				},
+			},
+		},
+	})
+
+	chaos := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/abort/1", nil)
+		req.Header.Set("X-Chaos", "on")
+		return req
+	}
+
+	// Disabled in the config: nothing happens until the admin API enables it
+	if resp := do(t, app, chaos()); resp.StatusCode != http.StatusOK || resp.Header.Get("X-Fault-Injected") != "" {
+		t.Fatalf("disabled fault: status %d, X-Fault-Injected %q", resp.StatusCode, resp.Header.Get("X-Fault-Injected"))
+	}
+
+	resp := do(t, app, adminRequest(http.MethodPut, "/admin/routes/abort/fault", strings.NewReader(`{"enabled": true}`)))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("enabling the fault: status %d", resp.StatusCode)
+	}
+
+	resp = do(t, app, chaos())
+	if resp.StatusCode != http.StatusTeapot || resp.Header.Get("X-Fault-Injected") != "abort" {
+		t.Errorf("targeted request: status %d, X-Fault-Injected %q; want 418, abort", resp.StatusCode, resp.Header.Get("X-Fault-Injected"))
+	}
+
+	untargeted := httptest.NewRequest(http.MethodGet, "/abort/1", nil)
+	untargeted.Header.Set("X-Chaos", "off")
+	if resp := do(t, app, untargeted); resp.StatusCode != http.StatusOK {
+		t.Errorf("request without the header value: status %d, want 200", resp.StatusCode)
+	}
+
+	start := time.Now()
+	resp = do(t, app, httptest.NewRequest(http.MethodGet, "/delay/1", nil))
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("delayed request took %v, want at least 50ms", elapsed)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Upstream") != "orders" {
+		t.Errorf("delayed request: status %d from %q, want 200 from orders", resp.StatusCode, resp.Header.Get("X-Upstream"))
+	}
+	// The marker survives the upstream response replacing the headers
+	if got := resp.Header.Get("X-Fault-Injected"); got != "delay" {
+		t.Errorf("X-Fault-Injected %q on the proxied response, want delay", got)
+	}
+}
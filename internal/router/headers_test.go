@@ -0,0 +1,78 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"vibeway/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestHeaderTransforms(t *testing.T) {
+	var received http.Header
+	backend := newTestUpstream(t, "legacy", func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Header().Set("X-Envoy-Upstream-Service-Time", "12")
+		w.Header().Set("X-Envoy-Decorator-Operation", "legacy")
+		w.Header().Set("X-Debug-Trace", "on")
+		w.Header().Set("X-Legacy-Version", "7")
+	})
+	app := newTestGateway(t, config.Config{
+		Security:  config.SecurityConfig{JWT: testJWT},
+		Upstreams: map[string]config.UpstreamConfig{"legacy": backend},
+		Routes: []config.RouteConfig{{
+			Name:        "legacy",
+			Path:        "/legacy/*",
+			Methods:     []string{"GET"},
+			Upstream:    "legacy",
+			Middlewares: []string{"jwt"},
+			RequestHeaders: config.HeaderTransformConfig{
+				Set: map[string]string{
+					"X-Tenant": "${claims.tenant}",
+					"X-Plan":   "${claims.plan}",
+					"X-Route":  "${route}",
+				},
+				Remove: []string{"Authorization"},
+			},
+			ResponseHeaders: config.HeaderTransformConfig{
+				Remove: []string{"X-Envoy-*", "X-Debug-Trace"},
+				Rename: map[string]string{"X-Legacy-Version": "X-Api-Version"},
+				Add:    map[string]string{"X-Served-By": "vibeway/${route}"},
+			},
+		}},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/legacy/orders", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken(t, jwt.MapClaims{"sub": "u1", "tenant": "acme", "plan": "pro"}))
+	resp := do(t, app, req)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200", resp.StatusCode)
+	}
+
+	for name, want := range map[string]string{
+		"X-Tenant":      "acme",
+		"X-Plan":        "pro",
+		"X-Route":       "legacy",
+		"X-User-Id":     "u1",
+		"Authorization": "",
+	} {
+		if got := received.Get(name); got != want {
+			t.Errorf("upstream got %s %q, want %q", name, got, want)
+		}
+	}
+
+	for name, want := range map[string]string{
+		"X-Envoy-Upstream-Service-Time": "",
+		"X-Envoy-Decorator-Operation":   "",
+		"X-Debug-Trace":                 "",
+		"X-Legacy-Version":              "",
+		"X-Api-Version":                 "7",
+		"X-Served-By":                   "vibeway/legacy",
+	} {
+		if got := resp.Header.Get(name); got != want {
+			t.Errorf("client got %s %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package router
+
+import (
+	"vibeway/internal/config"
+	"vibeway/internal/middleware"
+	"vibeway/pkg/logger"
+)
+
+// maintenanceSwitches holds the global, per-route and per-upstream
+// maintenance toggles so the admin API can flip them at runtime.
+type maintenanceSwitches struct {
+	defaults  config.MaintenanceConfig // Global block, inherited by routes
+	global    *middleware.Maintenance
+	routes    map[string]*middleware.Maintenance
+	upstreams map[string]*middleware.Maintenance
+}
+
+func newMaintenanceSwitches(cfg config.Config) *maintenanceSwitches {
+	ms := &maintenanceSwitches{
+		defaults:  cfg.Maintenance,
+		routes:    make(map[string]*middleware.Maintenance),
+		upstreams: make(map[string]*middleware.Maintenance),
+	}
+
+	global, err := middleware.NewMaintenance("global", ms.defaults, config.MaintenanceConfig{}, cfg.Security.JWT)
+	if err != nil {
+		logger.Error("Invalid global maintenance config, bypass CIDRs ignored", err, nil)
+		ms.defaults.Bypass.CIDRs = nil
+		global, _ = middleware.NewMaintenance("global", ms.defaults, config.MaintenanceConfig{}, cfg.Security.JWT)
+	}
+	ms.global = global
+
+	for name, uCfg := range cfg.Upstreams {
+		m, err := middleware.NewMaintenance("upstream:"+name, uCfg.Maintenance, ms.defaults, cfg.Security.JWT)
+		if err != nil {
+			logger.Error("Invalid upstream maintenance config, switch unavailable", err, map[string]interface{}{"upstream": name})
+			continue
+		}
+		ms.upstreams[name] = m
+	}
+	return ms
+}
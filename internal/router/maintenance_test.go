@@ -0,0 +1,104 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"vibeway/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestMaintenanceSwitches(t *testing.T) {
+	app := newTestGateway(t, config.Config{
+		Admin:    testAdmin,
+		Security: config.SecurityConfig{JWT: testJWT},
+		Maintenance: config.MaintenanceConfig{
+			RetryAfterSeconds: 120,
+			Message:           "Database migration in progress",
+			Bypass:            config.MaintenanceBypassConfig{HeaderValue: "s3cret", Roles: []string{"sre"}},
+		},
+		Upstreams: map[string]config.UpstreamConfig{
+			"orders": newTestUpstream(t, "orders", nil),
+			"payments": func() config.UpstreamConfig {
+				u := newTestUpstream(t, "payments", nil)
+				u.Maintenance = config.MaintenanceConfig{Body: "<h1>Payments are down for maintenance</h1>", ContentType: "text/html"}
+				return u
+			}(),
+		},
+		Routes: []config.RouteConfig{
+			{Name: "orders", Path: "/orders/*", Methods: []string{"GET"}, Upstream: "orders"},
+			{Name: "payments", Path: "/payments/*", Methods: []string{"GET"}, Upstream: "payments"},
+		},
+	})
+
+	bypassHeader := func(r *http.Request) { r.Header.Set("X-Maintenance-Bypass", "s3cret") }
+	sreToken := func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer "+testToken(t, jwt.MapClaims{"sub": "u1", "roles": []string{"sre"}}))
+	}
+
+	// Each step flips a switch through the admin API or sends a request
+	steps := []struct {
+		toggle   string // Admin path to enable or disable
+		enable   bool
+		path     string
+		prepare  func(*http.Request)
+		want     int
+		wantBody string
+	}{
+		{path: "/orders/1", want: http.StatusOK},
+
+		{toggle: "/admin/routes/orders/maintenance", enable: true},
+		{path: "/orders/1", want: http.StatusServiceUnavailable, wantBody: "Database migration in progress"},
+		{path: "/orders/1", prepare: bypassHeader, want: http.StatusOK},
+		{path: "/orders/1", prepare: sreToken, want: http.StatusOK},
+		{path: "/payments/1", want: http.StatusOK},
+		{toggle: "/admin/routes/orders/maintenance", enable: false},
+
+		{toggle: "/admin/upstreams/payments/maintenance", enable: true},
+		{path: "/payments/1", want: http.StatusServiceUnavailable, wantBody: "<h1>Payments are down for maintenance</h1>"},
+		{path: "/payments/1", prepare: bypassHeader, want: http.StatusOK},
+		{path: "/orders/1", want: http.StatusOK},
+		{toggle: "/admin/upstreams/payments/maintenance", enable: false},
+
+		{toggle: "/admin/maintenance", enable: true},
+		{path: "/orders/1", want: http.StatusServiceUnavailable},
+		{path: "/payments/1", want: http.StatusServiceUnavailable},
+		{path: "/payments/1", prepare: sreToken, want: http.StatusOK},
+		{toggle: "/admin/maintenance", enable: false},
+		{path: "/payments/1", want: http.StatusOK},
+	}
+
+	for i, s := range steps {
+		if s.toggle != "" {
+			body := `{"enabled": false}`
+			if s.enable {
+				body = `{"enabled": true}`
+			}
+			if resp := do(t, app, adminRequest(http.MethodPut, s.toggle, strings.NewReader(body))); resp.StatusCode != http.StatusOK {
+				t.Fatalf("step %d: PUT %s: status %d", i, s.toggle, resp.StatusCode)
+			}
+			continue
+		}
+
+		req := httptest.NewRequest(http.MethodGet, s.path, nil)
+		if s.prepare != nil {
+			s.prepare(req)
+		}
+		resp := do(t, app, req)
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != s.want {
+			t.Errorf("step %d: GET %s: status %d, want %d", i, s.path, resp.StatusCode, s.want)
+			continue
+		}
+		if s.want == http.StatusServiceUnavailable && resp.Header.Get("Retry-After") != "120" {
+			t.Errorf("step %d: Retry-After %q, want the global 120", i, resp.Header.Get("Retry-After"))
+		}
+		if !strings.Contains(string(body), s.wantBody) {
+			t.Errorf("step %d: body %s, want it to contain %q", i, body, s.wantBody)
+		}
+	}
+}
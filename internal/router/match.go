@@ -0,0 +1,199 @@
+package router
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"vibeway/internal/config"
+	"vibeway/internal/metrics"
+	"vibeway/internal/transform"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// condition is a single compiled test such as `claims.tenant in [acme, globex]`.
+type condition struct {
+	source string // header, cookie, query or claims
+	name   string
+	op     string
+	values []string
+	re     *regexp.Regexp
+}
+
+type rule struct {
+	upstream   string
+	conditions []condition
+}
+
+// Matcher picks an upstream from an ordered list of rules. The first rule
+// whose conditions all hold wins.
+type Matcher struct {
+	route string
+	rules []rule
+}
+
+// NewMatcher returns nil if the route has no rules configured.
+func NewMatcher(route string, cfgs []config.MatchRuleConfig) (*Matcher, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+
+	m := &Matcher{route: route}
+	for i, rc := range cfgs {
+		if rc.Upstream == "" {
+			return nil, fmt.Errorf("rule %d has no upstream", i)
+		}
+		r := rule{upstream: rc.Upstream}
+		for _, expr := range rc.When {
+			cond, err := parseCondition(expr)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i, err)
+			}
+			r.conditions = append(r.conditions, cond)
+		}
+		m.rules = append(m.rules, r)
+	}
+	return m, nil
+}
+
+// Match returns the upstream of the first matching rule.
+func (m *Matcher) Match(c fiber.Ctx) (string, bool) {
+	claims, _ := c.Locals("claims").(jwt.MapClaims)
+
+	for _, r := range m.rules {
+		matched := true
+		for _, cond := range r.conditions {
+			if !cond.eval(c, claims) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			metrics.VariantRequestsTotal.WithLabelValues(m.route, r.upstream).Inc()
+			return r.upstream, true
+		}
+	}
+	return "", false
+}
+
+// parseCondition parses `<source>.<name> <op> [value]`. Supported operators
+// are ==, !=, in, not_in, contains, matches and exists. List values are
+// written as [a, b, c]; values may be single or double quoted.
+func parseCondition(expr string) (condition, error) {
+	fields := strings.Fields(expr)
+	if len(fields) < 2 {
+		return condition{}, fmt.Errorf("invalid condition %q", expr)
+	}
+
+	source, name, ok := strings.Cut(fields[0], ".")
+	if !ok || name == "" {
+		return condition{}, fmt.Errorf("condition %q must start with header.<name>, cookie.<name>, query.<name> or claims.<name>", expr)
+	}
+	switch source {
+	case "header", "cookie", "query", "claims":
+	default:
+		return condition{}, fmt.Errorf("unknown source %q in condition %q", source, expr)
+	}
+
+	cond := condition{source: source, name: name, op: fields[1]}
+	rest := strings.TrimSpace(expr)
+	rest = strings.TrimSpace(rest[len(fields[0]):])
+	rest = strings.TrimSpace(rest[len(fields[1]):])
+
+	switch cond.op {
+	case "exists":
+		return cond, nil
+	case "==", "!=", "contains":
+		cond.values = []string{unquote(rest)}
+	case "in", "not_in":
+		if !strings.HasPrefix(rest, "[") || !strings.HasSuffix(rest, "]") {
+			return condition{}, fmt.Errorf("operator %s needs a [list] in condition %q", cond.op, expr)
+		}
+		for _, v := range strings.Split(rest[1:len(rest)-1], ",") {
+			if v = unquote(strings.TrimSpace(v)); v != "" {
+				cond.values = append(cond.values, v)
+			}
+		}
+	case "matches":
+		re, err := regexp.Compile(unquote(rest))
+		if err != nil {
+			return condition{}, fmt.Errorf("invalid regex in condition %q: %w", expr, err)
+		}
+		cond.re = re
+	default:
+		return condition{}, fmt.Errorf("unknown operator %q in condition %q", cond.op, expr)
+	}
+
+	if cond.op != "matches" && len(cond.values) == 0 {
+		return condition{}, fmt.Errorf("missing value in condition %q", expr)
+	}
+	return cond, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func (cond condition) eval(c fiber.Ctx, claims jwt.MapClaims) bool {
+	var value string
+	var present bool
+	var list []string // Set for array claims
+
+	switch cond.source {
+	case "header":
+		raw := c.Request().Header.Peek(cond.name)
+		value, present = string(raw), raw != nil
+	case "cookie":
+		value = c.Cookies(cond.name)
+		present = value != ""
+	case "query":
+		raw := c.Request().URI().QueryArgs().Peek(cond.name)
+		value, present = string(raw), raw != nil
+	case "claims":
+		var claim interface{}
+		if claims != nil {
+			claim, present = claims[cond.name]
+		}
+		if items, ok := claim.([]interface{}); ok {
+			for _, item := range items {
+				list = append(list, transform.ClaimString(item))
+			}
+		}
+		value = transform.ClaimString(claim)
+	}
+
+	switch cond.op {
+	case "exists":
+		return present
+	case "==":
+		return present && value == cond.values[0]
+	case "!=":
+		return !present || value != cond.values[0]
+	case "in":
+		return present && containsString(cond.values, value)
+	case "not_in":
+		return !present || !containsString(cond.values, value)
+	case "contains":
+		if list != nil {
+			return containsString(list, cond.values[0])
+		}
+		return present && strings.Contains(value, cond.values[0])
+	case "matches":
+		return present && cond.re.MatchString(value)
+	}
+	return false
+}
+
+func containsString(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
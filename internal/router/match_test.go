@@ -0,0 +1,91 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"vibeway/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRoutingRules(t *testing.T) {
+	app := newTestGateway(t, config.Config{
+		Security: config.SecurityConfig{JWT: testJWT},
+		Upstreams: map[string]config.UpstreamConfig{
+			"stable":   newTestUpstream(t, "stable", nil),
+			"beta":     newTestUpstream(t, "beta", nil),
+			"tenants":  newTestUpstream(t, "tenants", nil),
+			"internal": newTestUpstream(t, "internal", nil),
+		},
+		Routes: []config.RouteConfig{{
+			Path:        "/app/*",
+			Methods:     []string{"GET"},
+			Upstream:    "stable",
+			Middlewares: []string{"jwt"},
+			Rules: []config.MatchRuleConfig{
+				{Upstream: "internal", When: []string{"header.X-Employee exists", "query.debug == 1"}},
+				{Upstream: "tenants", When: []string{"claims.tenant in [acme, globex]"}},
+				{Upstream: "beta", When: []string{"claims.beta == true"}},
+				{Upstream: "beta", When: []string{"cookie.beta matches ^(1|true)$"}},
+			},
+			// Rules win over the split; unmatched requests all go to stable
+			Split: config.SplitConfig{
+				Variants:     []config.VariantConfig{{Upstream: "stable", Weight: 1}},
+				StickyCookie: "variant",
+			},
+		}},
+	})
+
+	send := func(t *testing.T, target string, claims jwt.MapClaims, prepare func(*http.Request)) *http.Response {
+		t.Helper()
+		claims["sub"] = "u1"
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken(t, claims))
+		if prepare != nil {
+			prepare(req)
+		}
+		return do(t, app, req)
+	}
+	expect := func(t *testing.T, resp *http.Response, want string) {
+		t.Helper()
+		if got := resp.Header.Get("X-Upstream"); got != want {
+			t.Errorf("routed to %q, want %q", got, want)
+		}
+	}
+
+	t.Run("tenant claim", func(t *testing.T) {
+		expect(t, send(t, "/app/", jwt.MapClaims{"tenant": "globex"}, nil), "tenants")
+	})
+	t.Run("tenant not listed", func(t *testing.T) {
+		expect(t, send(t, "/app/", jwt.MapClaims{"tenant": "initech"}, nil), "stable")
+	})
+	t.Run("boolean claim", func(t *testing.T) {
+		resp := send(t, "/app/", jwt.MapClaims{"beta": true}, nil)
+		expect(t, resp, "beta")
+		if len(resp.Cookies()) != 0 {
+			t.Error("a rule match set the split's sticky cookie")
+		}
+	})
+	t.Run("beta cookie", func(t *testing.T) {
+		expect(t, send(t, "/app/", jwt.MapClaims{}, func(r *http.Request) {
+			r.AddCookie(&http.Cookie{Name: "beta", Value: "true"})
+		}), "beta")
+	})
+	t.Run("all conditions must hold", func(t *testing.T) {
+		employee := func(r *http.Request) { r.Header.Set("X-Employee", "yes") }
+		expect(t, send(t, "/app/", jwt.MapClaims{}, employee), "stable")
+		expect(t, send(t, "/app/?debug=1", jwt.MapClaims{}, employee), "internal")
+	})
+	t.Run("first matching rule wins", func(t *testing.T) {
+		expect(t, send(t, "/app/", jwt.MapClaims{"tenant": "acme", "beta": true}, nil), "tenants")
+	})
+	t.Run("no rule falls back to the split", func(t *testing.T) {
+		resp := send(t, "/app/", jwt.MapClaims{}, nil)
+		expect(t, resp, "stable")
+		if len(resp.Cookies()) != 1 {
+			t.Errorf("got %d cookies, want the split's sticky cookie", len(resp.Cookies()))
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"vibeway/internal/config"
+)
+
+func TestMirrorDoesNotBlockPrimary(t *testing.T) {
+	type copyReceived struct {
+		header http.Header
+		body   string
+	}
+	mirrored := make(chan copyReceived, 1)
+	unblock := make(chan struct{})
+
+	shadow := newTestUpstream(t, "shadow", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mirrored <- copyReceived{header: r.Header.Clone(), body: string(body)}
+		<-unblock // Never answers while the test runs
+	})
+	// Cleanups run last in first out: free the handler before its server closes
+	t.Cleanup(func() { close(unblock) })
+	app := newTestGateway(t, config.Config{
+		Upstreams: map[string]config.UpstreamConfig{
+			"orders": newTestUpstream(t, "orders", nil),
+			"shadow": shadow,
+		},
+		Routes: []config.RouteConfig{{
+			Path:     "/orders/*",
+			Methods:  []string{"POST"},
+			Upstream: "orders",
+			Mirror: config.MirrorConfig{
+				Upstream:        "shadow",
+				Percentage:      100,
+				TimeoutMs:       5000,
+				RedactHeaders:   []string{"Authorization"},
+				RedactBodyPaths: []string{"$.card"},
+			},
+		}},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/orders/new", strings.NewReader(`{"item":"book","card":"4111"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+
+	start := time.Now()
+	resp := do(t, app, req)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("primary request took %v while the mirror hangs", elapsed)
+	}
+	if got := resp.Header.Get("X-Upstream"); got != "orders" {
+		t.Errorf("primary answered by %q, want orders", got)
+	}
+
+	select {
+	case got := <-mirrored:
+		if got.header.Get("Authorization") != "" {
+			t.Error("mirror copy kept the Authorization header")
+		}
+		if got.body != `{"item":"book"}` {
+			t.Errorf("mirror copy body %s, want the card removed", got.body)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("mirror never received the copy")
+	}
+}
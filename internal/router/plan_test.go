@@ -0,0 +1,102 @@
+package router
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"vibeway/internal/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestPlanAssignmentReachesEveryInstance(t *testing.T) {
+	cfg := config.Config{
+		Admin: testAdmin,
+		Security: config.SecurityConfig{
+			JWT: testJWT,
+			RateLimit: config.RateLimitConfig{
+				Algorithm:     "fixed_window",
+				WindowSeconds: 60,
+				Plans: map[string][]config.LimitConfig{
+					"free": {{Limit: 3}},
+					"pro":  {{Limit: 10}},
+				},
+				DefaultPlan:         "free",
+				PlanCacheTTLSeconds: 1,
+			},
+		},
+		Upstreams: map[string]config.UpstreamConfig{"search": newTestUpstream(t, "search", nil)},
+		Routes:    []config.RouteConfig{{Path: "/search/*", Methods: []string{"GET"}, Upstream: "search"}},
+	}
+	// Two gateways sharing Redis, each caching assignments for a second
+	mr := miniredis.RunT(t)
+	a := newTestInstance(t, mr, cfg)
+	b := newTestInstance(t, mr, cfg)
+	alice := "Bearer " + testToken(t, jwt.MapClaims{"sub": "alice"})
+
+	// search returns alice's limit and remaining requests on an instance
+	search := func(app *fiber.App) (limit, remaining string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/search/q", nil)
+		req.Header.Set("Authorization", alice)
+		resp := do(t, app, req)
+		return resp.Header.Get("X-RateLimit-Limit"), resp.Header.Get("X-RateLimit-Remaining")
+	}
+	plan := func(method, body string) (status int, assigned, effective string) {
+		t.Helper()
+		var r io.Reader
+		if body != "" {
+			r = strings.NewReader(body)
+		}
+		resp := do(t, a, adminRequest(method, "/admin/ratelimit/consumers/alice/plan", r))
+		var out struct {
+			Assigned string `json:"assigned"`
+			Plan     string `json:"plan"`
+		}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out.Assigned, out.Plan
+	}
+
+	if limit, remaining := search(b); limit != "3" || remaining != "2" {
+		t.Fatalf("before any assignment: limit %s, remaining %s; want the free plan's 3 and 2", limit, remaining)
+	}
+
+	if status, assigned, effective := plan(http.MethodPut, `{"plan": "enterprise"}`); status != http.StatusBadRequest {
+		t.Errorf("unknown plan: status %d, assigned %q, plan %q; want 400", status, assigned, effective)
+	}
+	if status, assigned, effective := plan(http.MethodPut, `{"plan": "pro"}`); status != http.StatusOK || assigned != "pro" || effective != "pro" {
+		t.Fatalf("assigning pro: status %d, assigned %q, plan %q", status, assigned, effective)
+	}
+
+	// The assigning instance applies it at once, keeping alice's usage
+	if limit, remaining := search(a); limit != "10" || remaining != "8" {
+		t.Errorf("on the assigning instance: limit %s, remaining %s; want 10 and 8", limit, remaining)
+	}
+
+	// The other one once its cached assignment expires
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		limit, _ := search(b)
+		if limit == "10" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("other instance still applies a limit of %s", limit)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if status, assigned, effective := plan(http.MethodDelete, ""); status != http.StatusOK || assigned != "" || effective != "free" {
+		t.Errorf("unassigning: status %d, assigned %q, plan %q; want the free default", status, assigned, effective)
+	}
+	if limit, _ := search(a); limit != "3" {
+		t.Errorf("after unassigning: limit %s, want 3", limit)
+	}
+}
@@ -0,0 +1,246 @@
+package router
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"vibeway/internal/concurrency"
+	"vibeway/internal/config"
+	"vibeway/internal/httpcache"
+	"vibeway/internal/middleware"
+	"vibeway/internal/proxy"
+	"vibeway/internal/transform"
+	"vibeway/internal/upstream"
+	"vibeway/pkg/logger"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/valyala/fasthttp"
+)
+
+// routeProxy is the terminal handler of a proxied route.
+type routeProxy struct {
+	cfg    config.RouteConfig
+	prefix string
+
+	client    *proxy.ProxyClient
+	upstreams *upstream.Manager
+
+	matcher   *Matcher
+	splitter  *Splitter
+	mirror    *proxy.Mirror
+	cache     *httpcache.Cache
+	coalescer *httpcache.Coalescer
+
+	maintenance map[string]*middleware.Maintenance      // By upstream name
+	concurrency map[string]*concurrency.Limiter         // By upstream name
+	adaptive    map[string]*concurrency.AdaptiveLimiter // By upstream name
+	shedder     *middleware.LoadShedder
+
+	rewriter        *proxy.Rewriter
+	requestHeaders  *transform.HeaderRules
+	responseHeaders *transform.HeaderRules
+	requestBody     *transform.BodyRules
+	responseBody    *transform.BodyRules
+}
+
+func (rp *routeProxy) handle(c fiber.Ctx) error {
+	upstreamName, sticky := rp.pickUpstream(c)
+	if m, ok := rp.maintenance[upstreamName]; ok && m.Active(c) {
+		return m.Reject(c)
+	}
+
+	forward := rp.prepare(c, upstreamName)
+	if rp.coalescer != nil {
+		forward = rp.coalescer.Wrap(c, upstreamName, forward)
+	}
+	var err error
+	if rp.cache != nil {
+		err = rp.cache.Serve(c, upstreamName, forward)
+	} else {
+		err = forward(c.Request(), c.Response())
+	}
+
+	// Set after proxying, which replaces the response headers
+	if sticky {
+		rp.splitter.Stick(c, upstreamName)
+	}
+	return err
+}
+
+// prepare resolves everything that depends on the fiber context and returns
+// a forward function that only needs a request and a response, so it can
+// also be run in the background (e.g. cache revalidation). Upstream
+// concurrency slots are only taken around the upstream call, so cache hits
+// and coalesced requests never use them.
+func (rp *routeProxy) prepare(c fiber.Ctx, upstreamName string) httpcache.FetchFunc {
+	// Handle path rewriting
+	// If route path ends with /*, strip the prefix
+	reqPath := c.Path()
+	if rp.prefix != "" && strings.HasPrefix(reqPath, rp.prefix) {
+		reqPath = strings.TrimPrefix(reqPath, rp.prefix)
+	}
+
+	// Ensure leading slash
+	if !strings.HasPrefix(reqPath, "/") {
+		reqPath = "/" + reqPath
+	}
+	if query := c.Request().URI().QueryString(); len(query) > 0 {
+		reqPath += "?" + string(query)
+	} else {
+		reqPath = strings.Clone(reqPath)
+	}
+
+	vars := transform.Vars{
+		ClientIP:  strings.Clone(c.IP()),
+		RequestID: middleware.GetRequestID(c),
+		Route:     rp.cfg.RouteName(),
+	}
+	vars.Claims, _ = c.Locals("claims").(jwt.MapClaims)
+	publicBase := c.Scheme() + "://" + c.Host()
+	log := middleware.Log(c)
+
+	limiter := rp.concurrency[upstreamName]
+	adaptive := rp.adaptive[upstreamName]
+	var class string
+	if adaptive != nil {
+		class = rp.shedder.Class(c, rp.cfg.Criticality)
+	}
+
+	return func(req *fasthttp.Request, resp *fasthttp.Response) error {
+		u, ok := rp.upstreams.GetUpstream(upstreamName)
+		if !ok {
+			return fiber.NewError(fiber.StatusBadGateway, "Upstream not found")
+		}
+
+		targetURL, ok := u.GetNextURL()
+		if !ok {
+			return fiber.NewError(fiber.StatusServiceUnavailable, "No healthy upstream available")
+		}
+
+		if limiter != nil {
+			// Waiting in the queue is bounded by its timeout
+			release, err := middleware.AcquireConcurrency(context.Background(), limiter, "", log)
+			if err != nil {
+				return err
+			}
+			defer release()
+		}
+		var inflight *concurrency.Inflight
+		if adaptive != nil {
+			// Lower classes may only use part of the limit
+			if inflight, ok = adaptive.Acquire(rp.shedder.Share(class)); !ok {
+				return rp.shedder.Rejection("upstream:"+upstreamName, class)
+			}
+			defer inflight.Release()
+		}
+
+		// Track active connections
+		u.IncConnection(targetURL)
+		defer u.DecConnection(targetURL)
+
+		v := vars
+		v.UpstreamURL = targetURL
+
+		if !rp.requestHeaders.Empty() {
+			rp.requestHeaders.Apply(&req.Header, &v)
+		}
+		if !rp.requestBody.Empty() {
+			if body, ok := rp.requestBody.Transform(req.Body(), string(req.Header.ContentType()), string(req.Header.ContentEncoding())); ok {
+				req.SetBody(body)
+			}
+		}
+
+		if rp.mirror != nil && rp.mirror.Sample() {
+			if mu, ok := rp.upstreams.GetUpstream(rp.mirror.Upstream()); ok {
+				if mirrorURL, ok := mu.GetNextURL(); ok {
+					rp.mirror.Send(req, mirrorURL+reqPath)
+				}
+			}
+		}
+
+		// Response operations need a body they can read. The client's
+		// Accept-Encoding is restored for the compression middleware.
+		var acceptEncoding string
+		identity := !rp.responseBody.Empty() || rp.rewriter.RewritesBody()
+		if identity {
+			acceptEncoding = string(req.Header.Peek(fiber.HeaderAcceptEncoding))
+			req.Header.Set(fiber.HeaderAcceptEncoding, "identity")
+		}
+
+		start := time.Now()
+		err := rp.client.Do(req, resp, targetURL+reqPath)
+		inflight.Observe(time.Since(start), err != nil || overloaded(resp.StatusCode()))
+		if identity {
+			if acceptEncoding != "" {
+				req.Header.Set(fiber.HeaderAcceptEncoding, acceptEncoding)
+			} else {
+				req.Header.Del(fiber.HeaderAcceptEncoding)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		if !rp.responseBody.Empty() {
+			rp.transformResponseBody(resp, log)
+		}
+		if rp.rewriter.Enabled() {
+			rp.rewriter.Apply(resp, u.URLs, publicBase, rp.prefix)
+		}
+		if !rp.responseHeaders.Empty() {
+			rp.responseHeaders.Apply(&resp.Header, &v)
+		}
+		return nil
+	}
+}
+
+// transformResponseBody applies the response body operations, decoding the
+// body first if the upstream encoded it anyway.
+func (rp *routeProxy) transformResponseBody(resp *fasthttp.Response, log *logger.Logger) {
+	body := resp.Body()
+	if len(resp.Header.ContentEncoding()) > 0 {
+		decoded, err := resp.BodyUncompressed()
+		if err != nil {
+			log.Warn("Response body not transformed, cannot decode it", map[string]interface{}{
+				"route":    rp.cfg.RouteName(),
+				"encoding": string(resp.Header.ContentEncoding()),
+				"error":    err.Error(),
+			})
+			return
+		}
+		body = decoded
+	}
+
+	if out, ok := rp.responseBody.Transform(body, string(resp.Header.ContentType()), ""); ok {
+		resp.SetBody(out)
+		resp.Header.Del(fiber.HeaderContentEncoding)
+	}
+}
+
+// pickUpstream applies routing rules, then the traffic split, then the
+// route's default upstream. sticky reports a split draw that should be
+// remembered in the sticky cookie.
+func (rp *routeProxy) pickUpstream(c fiber.Ctx) (name string, sticky bool) {
+	if name, ok := matchUpstream(c, rp.matcher); ok {
+		return name, false
+	}
+	if rp.splitter != nil {
+		return rp.splitter.Pick(c)
+	}
+	return rp.cfg.Upstream, false
+}
+
+// overloaded reports upstream answers that signal overload to adaptive
+// concurrency limits.
+func overloaded(status int) bool {
+	return status == fiber.StatusTooManyRequests || status == fiber.StatusServiceUnavailable || status == fiber.StatusGatewayTimeout
+}
+
+func matchUpstream(c fiber.Ctx, m *Matcher) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	return m.Match(c)
+}
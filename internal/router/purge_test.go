@@ -0,0 +1,99 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"vibeway/internal/config"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestCachePurgeReachesEveryInstance(t *testing.T) {
+	// By upstream path; the route prefix is stripped
+	tags := map[string]string{
+		"/1": "user-1 team-7",
+		"/2": "user-2 team-7",
+		"/3": "user-3",
+	}
+	backend := newTestUpstream(t, "users", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=300")
+		w.Header().Set("Surrogate-Key", tags[r.URL.Path])
+	})
+	cfg := config.Config{
+		Admin:     testAdmin,
+		Upstreams: map[string]config.UpstreamConfig{"users": backend},
+		Routes: []config.RouteConfig{{
+			Path:     "/users/*",
+			Methods:  []string{"GET"},
+			Upstream: "users",
+			Cache:    config.CacheConfig{Enabled: true},
+		}},
+	}
+	// Two gateways sharing Redis, each with its own memory tier
+	mr := miniredis.RunT(t)
+	a := newTestInstance(t, mr, cfg)
+	b := newTestInstance(t, mr, cfg)
+
+	lookup := func(path string) string {
+		t.Helper()
+		resp := do(t, b, httptest.NewRequest(http.MethodGet, path, nil))
+		if resp.Header.Get("Surrogate-Key") != "" {
+			t.Errorf("%s: Surrogate-Key leaked to the client", path)
+		}
+		return resp.Header.Get("X-Cache")
+	}
+	purge := func(body string) int64 {
+		t.Helper()
+		resp := do(t, a, adminRequest(http.MethodPost, "/admin/cache/purge", strings.NewReader(body)))
+		var out struct {
+			Purged int64 `json:"purged"`
+		}
+		if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&out) != nil {
+			t.Fatalf("purge %s: status %d", body, resp.StatusCode)
+		}
+		return out.Purged
+	}
+	// Purges reach other instances through pub/sub, not at once
+	eventuallyMiss := func(path string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for lookup(path) != "MISS" {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s still cached on the other instance", path)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	for _, path := range []string{"/users/1", "/users/2", "/users/3"} {
+		lookup(path)
+		if got := lookup(path); got != "HIT" {
+			t.Fatalf("%s: X-Cache %q after warming, want HIT", path, got)
+		}
+	}
+
+	// Two entries and the tag's index
+	if n := purge(`{"tags": ["team-7"]}`); n != 3 {
+		t.Errorf("tag purge removed %d keys, want 3", n)
+	}
+	eventuallyMiss("/users/1")
+	eventuallyMiss("/users/2")
+	if got := lookup("/users/3"); got != "HIT" {
+		t.Errorf("untagged entry: X-Cache %q, want HIT", got)
+	}
+
+	if n := purge(`{"path": "/users/*"}`); n != 3 {
+		t.Errorf("path purge removed %d keys, want 3", n)
+	}
+	eventuallyMiss("/users/3")
+
+	resp := do(t, a, adminRequest(http.MethodPost, "/admin/cache/purge", strings.NewReader(`{}`)))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("empty purge: status %d, want 400", resp.StatusCode)
+	}
+}
@@ -0,0 +1,101 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"vibeway/internal/config"
+	"vibeway/internal/quota"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestQuotas(t *testing.T) {
+	app := newTestGateway(t, config.Config{
+		Security:  config.SecurityConfig{JWT: testJWT},
+		Admin:     testAdmin,
+		Quotas:    []config.QuotaConfig{{Name: "partner", Limit: 2, Period: "month", Timezone: "Europe/Berlin", Identity: "sub"}},
+		Upstreams: map[string]config.UpstreamConfig{"reports": newTestUpstream(t, "reports", nil)},
+		Routes:    []config.RouteConfig{{Path: "/reports/*", Methods: []string{"GET"}, Upstream: "reports"}},
+	})
+	alice := "Bearer " + testToken(t, jwt.MapClaims{"sub": "alice"})
+
+	call := func(auth string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/reports/monthly", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		return do(t, app, req)
+	}
+	// expectQuota checks the status and quota headers of a call by alice
+	expectQuota := func(status int, limit, remaining string) {
+		t.Helper()
+		resp := call(alice)
+		if resp.StatusCode != status {
+			t.Fatalf("status %d, want %d", resp.StatusCode, status)
+		}
+		if got := resp.Header.Get("X-Quota-Limit"); got != limit {
+			t.Errorf("X-Quota-Limit = %q, want %q", got, limit)
+		}
+		if got := resp.Header.Get("X-Quota-Remaining"); got != remaining {
+			t.Errorf("X-Quota-Remaining = %q, want %q", got, remaining)
+		}
+		if resp.Header.Get("X-Quota-Reset") == "" {
+			t.Error("no X-Quota-Reset header")
+		}
+	}
+	usage := func(req *http.Request) quota.Usage {
+		t.Helper()
+		resp := do(t, app, req)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s %s: status %d", req.Method, req.URL.Path, resp.StatusCode)
+		}
+		var u quota.Usage
+		if err := json.NewDecoder(resp.Body).Decode(&u); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	const admin = "/admin/quotas/partner/consumers/alice"
+
+	// Requests without a subject are not counted
+	if resp := call(""); resp.StatusCode != http.StatusOK || resp.Header.Get("X-Quota-Limit") != "" {
+		t.Fatalf("anonymous request: status %d, X-Quota-Limit %q", resp.StatusCode, resp.Header.Get("X-Quota-Limit"))
+	}
+
+	// Headers are set on proxied responses too
+	expectQuota(http.StatusOK, "2", "1")
+	if resp := call(alice); resp.Header.Get("X-Upstream") != "reports" || resp.Header.Get("X-Quota-Remaining") != "0" {
+		t.Fatalf("second request: X-Upstream %q, X-Quota-Remaining %q", resp.Header.Get("X-Upstream"), resp.Header.Get("X-Quota-Remaining"))
+	}
+	expectQuota(http.StatusTooManyRequests, "2", "0")
+
+	u := usage(adminRequest(http.MethodGet, admin, nil))
+	if u.Limit != 2 || u.Remaining != 0 || u.Period == "" {
+		t.Errorf("usage = %+v, want limit 2 with none remaining", u)
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reset := u.ResetsAt.In(berlin); reset.Day() != 1 || reset.Hour() != 0 || reset.Minute() != 0 {
+		t.Errorf("resets at %v, want the start of a month in Berlin", reset)
+	}
+
+	u = usage(adminRequest(http.MethodPost, admin+"/top-up", strings.NewReader(`{"amount": 3}`)))
+	if u.TopUp != 3 {
+		t.Errorf("top-up = %d, want 3", u.TopUp)
+	}
+	expectQuota(http.StatusOK, "5", "2")
+
+	u = usage(adminRequest(http.MethodPost, admin+"/reset", nil))
+	if u.Used != 0 || u.TopUp != 3 {
+		t.Errorf("after reset used = %d, top-up = %d, want 0 and the kept 3", u.Used, u.TopUp)
+	}
+	expectQuota(http.StatusOK, "5", "4")
+}
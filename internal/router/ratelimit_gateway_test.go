@@ -0,0 +1,77 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"vibeway/internal/config"
+	"vibeway/internal/metrics"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGatewayRateLimitTiers(t *testing.T) {
+	app := newTestGateway(t, config.Config{
+		Security: config.SecurityConfig{
+			JWT: testJWT,
+			RateLimit: config.RateLimitConfig{
+				GlobalPerMinute: 100,
+				PerIP:           3,
+				PerConsumer:     2,
+				Algorithm:       "fixed_window",
+				WindowSeconds:   60,
+			},
+		},
+		Upstreams: map[string]config.UpstreamConfig{"orders": newTestUpstream(t, "orders", nil)},
+		Routes:    []config.RouteConfig{{Path: "/orders/*", Methods: []string{"GET"}, Upstream: "orders"}},
+	})
+	alice := "Bearer " + testToken(t, jwt.MapClaims{"sub": "alice"})
+
+	// rejectedBy sends a request and returns the tier that rejected it, or
+	// "" if it went through.
+	rejectedBy := func(path, auth string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp := do(t, app, req)
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return ""
+		}
+		var body struct {
+			Tier string `json:"tier"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return body.Tier
+	}
+	hits := func(tier string) float64 {
+		return testutil.ToFloat64(metrics.RateLimitHitsTotal.WithLabelValues("*", "0.0.0.0", tier))
+	}
+	consumerHits, ipHits := hits("consumer"), hits("ip")
+
+	for i, want := range []string{"", "", "consumer"} {
+		if got := rejectedBy("/orders/1", alice); got != want {
+			t.Errorf("alice request %d: rejected by %q, want %q", i, got, want)
+		}
+	}
+
+	// Anonymous requests skip the consumer tier, but not the IP tier. The
+	// rejected request above took nothing from it, leaving one request.
+	// Unrouted paths are limited too, as the tiers run before route matching.
+	for i, want := range []string{"", "ip"} {
+		if got := rejectedBy("/no/such/route", ""); got != want {
+			t.Errorf("anonymous request %d: rejected by %q, want %q", i, got, want)
+		}
+	}
+
+	if got := hits("consumer") - consumerHits; got != 1 {
+		t.Errorf("consumer tier hits went up by %v, want 1", got)
+	}
+	if got := hits("ip") - ipHits; got != 1 {
+		t.Errorf("ip tier hits went up by %v, want 1", got)
+	}
+}
@@ -0,0 +1,89 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"vibeway/internal/config"
+	"vibeway/internal/metrics"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// outage returns a gateway allowing 4 requests per IP across 2 instances,
+// whose Redis has gone away. Its breaker opens on the first failure.
+func outage(t *testing.T, failureMode string) func() int {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	app := newTestInstance(t, mr, config.Config{
+		Security: config.SecurityConfig{RateLimit: config.RateLimitConfig{
+			PerIP:         4,
+			Algorithm:     "fixed_window",
+			WindowSeconds: 60,
+			FailureMode:   failureMode,
+			Instances:     2,
+			RedisBreaker:  config.CircuitBreakerConfig{FailureThreshold: 1, ResetTimeoutMs: 60000},
+		}},
+		Upstreams: map[string]config.UpstreamConfig{"users": newTestUpstream(t, "users", nil)},
+		Routes:    []config.RouteConfig{{Path: "/users/*", Methods: []string{"GET"}, Upstream: "users"}},
+	})
+	mr.Close()
+
+	return func() int {
+		// The client retries its dials before the breaker opens
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/users/1", nil), fiber.TestConfig{Timeout: 10 * time.Second})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+}
+
+func TestRateLimitLocalFallback(t *testing.T) {
+	get := outage(t, "local")
+
+	// Each of the 2 instances takes half of the cluster limit
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if got := get(); got != want {
+			t.Errorf("request %d: status %d, want %d", i, got, want)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.RateLimiterMode.WithLabelValues("local")); got != 1 {
+		t.Errorf("local mode gauge = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.RateLimiterMode.WithLabelValues("redis")); got != 0 {
+		t.Errorf("redis mode gauge = %v, want 0", got)
+	}
+}
+
+func TestRateLimitFailClosed(t *testing.T) {
+	get := outage(t, "fail_closed")
+	if got := get(); got != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503", got)
+	}
+
+	// With the breaker open, requests no longer wait on Redis
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if got := get(); got != http.StatusServiceUnavailable {
+			t.Fatalf("request %d: status %d, want 503", i, got)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("requests took %v with the breaker open", elapsed)
+	}
+}
+
+func TestRateLimitFailOpen(t *testing.T) {
+	get := outage(t, "fail_open")
+	for i := 0; i < 6; i++ {
+		if got := get(); got != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i, got)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"vibeway/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestCompositeRateLimitKeys(t *testing.T) {
+	app := newTestGateway(t, config.Config{
+		Security:  config.SecurityConfig{JWT: testJWT},
+		Upstreams: map[string]config.UpstreamConfig{"reports": newTestUpstream(t, "reports", nil)},
+		Routes: []config.RouteConfig{{
+			Name:        "reports",
+			Path:        "/reports/*",
+			Methods:     []string{"GET"},
+			Upstream:    "reports",
+			Middlewares: []string{"jwt", "ratelimit"},
+			RateLimits: []config.LimitConfig{
+				{Name: "per-user", Algorithm: "fixed_window", Limit: 2, WindowSeconds: 60, Key: []string{"sub"}},
+				{Name: "per-route", Algorithm: "fixed_window", Limit: 3, WindowSeconds: 60, Key: []string{"route"}},
+			},
+		}},
+	})
+
+	tokens := map[string]string{
+		"alice": testToken(t, jwt.MapClaims{"sub": "alice"}),
+		"bob":   testToken(t, jwt.MapClaims{"sub": "bob"}),
+	}
+	send := func(user string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, "/reports/daily", nil)
+		req.Header.Set("Authorization", "Bearer "+tokens[user])
+		return do(t, app, req)
+	}
+
+	// Alice runs out of her own allowance; Bob then takes the route's last slot
+	for i, want := range []struct {
+		user  string
+		limit string // Rejecting limit, empty if allowed
+	}{
+		{"alice", ""},
+		{"alice", ""},
+		{"alice", "per-user"},
+		{"bob", ""},
+		{"bob", "per-route"},
+	} {
+		resp := send(want.user)
+		if want.limit == "" {
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("request %d (%s): status %d, want 200", i, want.user, resp.StatusCode)
+			}
+			// Both limits are reported on the proxied response
+			policy := resp.Header.Get("RateLimit-Policy")
+			if !strings.Contains(policy, `"per-user"`) || !strings.Contains(policy, `"per-route"`) || resp.Header.Get("RateLimit") == "" {
+				t.Errorf("request %d: RateLimit-Policy %q, RateLimit %q", i, policy, resp.Header.Get("RateLimit"))
+			}
+			continue
+		}
+
+		var body struct {
+			Tier  string `json:"tier"`
+			Limit string `json:"limit"`
+		}
+		if resp.StatusCode != http.StatusTooManyRequests || json.NewDecoder(resp.Body).Decode(&body) != nil {
+			t.Fatalf("request %d (%s): status %d, want 429", i, want.user, resp.StatusCode)
+		}
+		if body.Limit != want.limit || body.Tier != "route" {
+			t.Errorf("request %d (%s): rejected by %s/%s, want route/%s", i, want.user, body.Tier, body.Limit, want.limit)
+		}
+		if resp.Header.Get("Retry-After") == "" {
+			t.Errorf("request %d: no Retry-After", i)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"vibeway/internal/config"
+)
+
+func TestRequestIDCorrelation(t *testing.T) {
+	var forwarded string
+	backend := newTestUpstream(t, "orders", func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get("X-Correlation-Id")
+	})
+	// A closed server makes the gateway answer with its own error body
+	down := httptest.NewServer(nil)
+	down.Close()
+
+	app := newTestGateway(t, config.Config{
+		Server: config.ServerConfig{RequestID: config.RequestIDConfig{Header: "X-Correlation-Id", Generator: "ulid"}},
+		Upstreams: map[string]config.UpstreamConfig{
+			"orders": backend,
+			"down":   {URLs: []string{down.URL}},
+		},
+		Routes: []config.RouteConfig{
+			{Path: "/orders/*", Methods: []string{"GET"}, Upstream: "orders"},
+			{Path: "/down/*", Methods: []string{"GET"}, Upstream: "down"},
+		},
+	})
+	ulid := regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`)
+
+	t.Run("incoming ID is kept", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/orders/1", nil)
+		req.Header.Set("X-Correlation-Id", "client-req-0001")
+		resp := do(t, app, req)
+
+		if got := resp.Header.Get("X-Correlation-Id"); got != "client-req-0001" {
+			t.Errorf("echoed ID %q, want the client's", got)
+		}
+		if forwarded != "client-req-0001" {
+			t.Errorf("upstream got ID %q, want the client's", forwarded)
+		}
+	})
+
+	t.Run("malformed ID is replaced", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/orders/1", nil)
+		req.Header.Set("X-Correlation-Id", "bad id\t")
+		resp := do(t, app, req)
+
+		id := resp.Header.Get("X-Correlation-Id")
+		if !ulid.MatchString(id) {
+			t.Fatalf("echoed ID %q, want a generated ULID", id)
+		}
+		if forwarded != id {
+			t.Errorf("upstream got ID %q, want %q", forwarded, id)
+		}
+	})
+
+	t.Run("error body carries the ID", func(t *testing.T) {
+		resp := do(t, app, httptest.NewRequest(http.MethodGet, "/down/1", nil))
+		if resp.StatusCode != http.StatusBadGateway {
+			t.Fatalf("status %d, want 502", resp.StatusCode)
+		}
+
+		var body struct {
+			RequestID string `json:"request_id"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decoding error body: %v", err)
+		}
+		if id := resp.Header.Get("X-Correlation-Id"); body.RequestID != id || !ulid.MatchString(id) {
+			t.Errorf("error body ID %q, header ID %q; want the same generated ULID", body.RequestID, id)
+		}
+	})
+}
@@ -1,87 +1,305 @@
 package router
 
 import (
+	"fmt"
 	"strings"
 	"time"
+	"vibeway/internal/concurrency"
 	"vibeway/internal/config"
+	"vibeway/internal/httpcache"
 	"vibeway/internal/middleware"
 	"vibeway/internal/proxy"
+	"vibeway/internal/quota"
+	"vibeway/internal/ratelimit"
+	"vibeway/internal/transform"
 	"vibeway/internal/upstream"
+	"vibeway/pkg/cache"
+	"vibeway/pkg/logger"
 
 	"github.com/gofiber/fiber/v3"
 )
 
-func SetupRoutes(app *fiber.App, cfg config.Config, upstreams *upstream.Manager) {
+func SetupRoutes(app *fiber.App, cfg config.Config, upstreams *upstream.Manager, adminAPI fiber.Router) {
 	proxyClient := proxy.NewProxyClient(
 		time.Duration(cfg.Server.RequestTimeoutMs)*time.Millisecond,
 		time.Duration(cfg.Server.RequestTimeoutMs)*time.Millisecond,
+		middleware.RequestIDHeader(cfg.Server.RequestID),
 	)
 
+	splitters := make(map[string]*Splitter)
+	faults := make(map[string]*middleware.FaultInjector)
+	var responseStore *httpcache.Store
+
+	maintenance := newMaintenanceSwitches(cfg)
+	limiter := ratelimit.NewLimiter(cache.Client, cfg.Security.RateLimit)
+
+	// Gateway-wide tiers run before any route is matched
+	gatewayLimits, err := ratelimit.GatewayLimits(cfg.Security.RateLimit)
+	if err != nil {
+		logger.Error("Invalid gateway rate limits, gateway-wide limiting disabled", err, nil)
+	}
+	plans, err := ratelimit.NewPlans(cache.Client, cfg.Security.RateLimit, limiter.Breaker())
+	if err != nil {
+		logger.Error("Invalid rate limit plans, plans disabled", err, nil)
+		plans = nil
+	}
+	if len(gatewayLimits) > 0 || plans != nil {
+		app.Use(middleware.GatewayRateLimit(limiter, gatewayLimits, plans, cfg.Security.JWT))
+	}
+
+	upstreamConcurrency := make(map[string]*concurrency.Limiter)
+	adaptiveConcurrency := make(map[string]*concurrency.AdaptiveLimiter)
+	for name, uCfg := range cfg.Upstreams {
+		l, err := concurrency.NewLimiter("upstream:"+name, uCfg.Concurrency, cache.Client)
+		if err != nil {
+			logger.Error("Invalid upstream concurrency limit, limit disabled", err, map[string]interface{}{"upstream": name})
+		} else if l != nil {
+			upstreamConcurrency[name] = l
+		}
+
+		a, err := concurrency.NewAdaptiveLimiter(name, uCfg.AdaptiveConcurrency)
+		if err != nil {
+			logger.Error("Invalid adaptive concurrency config, limit disabled", err, map[string]interface{}{"upstream": name})
+		} else if a != nil {
+			adaptiveConcurrency[name] = a
+		}
+	}
+
+	shedder, err := middleware.NewLoadShedder(cfg.LoadShedding, cfg.Security.JWT)
+	if err != nil {
+		logger.Error("Invalid load shedding config, classes ignored", err, nil)
+		shedder, _ = middleware.NewLoadShedder(config.LoadSheddingConfig{}, cfg.Security.JWT)
+	}
+
+	policies, err := quota.NewPolicies(cfg.Quotas)
+	if err != nil {
+		logger.Error("Invalid quotas, quotas disabled", err, nil)
+		policies = nil
+	}
+	quotas := quota.NewManager(cache.Client, policies, limiter.Breaker())
+
 	for _, rCfg := range cfg.Routes {
+		prefix := routePrefix(rCfg.Path)
+		rewriter := proxy.NewRewriter(rCfg.ResponseRewrite)
+		requestHeaders := transform.NewHeaderRules(rCfg.RequestHeaders)
+		responseHeaders := transform.NewHeaderRules(rCfg.ResponseHeaders)
+
+		requestBody, err := transform.NewBodyRules(rCfg.RequestBody)
+		if err != nil {
+			logger.Error("Invalid request body transform, route disabled", err, map[string]interface{}{"route": rCfg.RouteName()})
+			continue
+		}
+		responseBody, err := transform.NewBodyRules(rCfg.ResponseBody)
+		if err != nil {
+			logger.Error("Invalid response body transform, route disabled", err, map[string]interface{}{"route": rCfg.RouteName()})
+			continue
+		}
+		splitter := NewSplitter(rCfg.RouteName(), rCfg.Split)
+		if splitter != nil {
+			splitters[rCfg.RouteName()] = splitter
+		}
+		matcher, err := NewMatcher(rCfg.RouteName(), rCfg.Rules)
+		if err != nil {
+			logger.Error("Invalid routing rules, route disabled", err, map[string]interface{}{"route": rCfg.RouteName()})
+			continue
+		}
+		mirror, err := proxy.NewMirror(rCfg.RouteName(), rCfg.Mirror)
+		if err != nil {
+			logger.Error("Invalid mirror config, mirroring disabled", err, map[string]interface{}{"route": rCfg.RouteName()})
+		}
+
 		// Build middleware chain
 		var handlers []any
 
 		// Security first
 		handlers = append(handlers, middleware.Security())
 
+		// Maintenance before auth so anonymous clients get 503, not 401
+		routeMaintenance, err := middleware.NewMaintenance("route:"+rCfg.RouteName(), rCfg.Maintenance, maintenance.defaults, cfg.Security.JWT)
+		if err != nil {
+			logger.Error("Invalid maintenance config, route disabled", err, map[string]interface{}{"route": rCfg.RouteName()})
+			continue
+		}
+		maintenance.routes[rCfg.RouteName()] = routeMaintenance
+		handlers = append(handlers, maintenance.global.Handler(), routeMaintenance.Handler())
+
+		if rCfg.Criticality != "" && !middleware.ValidClass(rCfg.Criticality) {
+			logger.Error("Invalid criticality, route disabled", fmt.Errorf("unknown class %q", rCfg.Criticality), map[string]interface{}{"route": rCfg.RouteName()})
+			continue
+		}
+		// Shed overload before spending anything on the request
+		if shedder.Enabled() {
+			handlers = append(handlers, shedder.Handler(rCfg.Criticality))
+		}
+
+		// Compression wraps everything below it. Errors returned down the
+		// chain are rendered later by the app's ErrorHandler, uncompressed;
+		// their small JSON bodies are under any sensible min_bytes anyway.
+		if rCfg.Compression.Enabled {
+			handlers = append(handlers, middleware.Compression(rCfg.Compression))
+		}
+
 		for _, mw := range rCfg.Middlewares {
 			switch mw {
 			case "jwt":
 				handlers = append(handlers, middleware.JWT(cfg.Security.JWT))
 			case "ratelimit":
-				handlers = append(handlers, middleware.RateLimit(
-					cfg.Security.RateLimit.PerRoute,
-					time.Minute,
-				))
+				coster, err := ratelimit.NewCoster(rCfg.Cost)
+				if err != nil {
+					logger.Error("Invalid rate limit cost, rate limiting disabled", err, map[string]interface{}{"route": rCfg.RouteName()})
+					continue
+				}
+				limits, err := routeLimits(rCfg, cfg.Security.RateLimit, coster != nil)
+				if err != nil {
+					logger.Error("Invalid rate limit, rate limiting disabled", err, map[string]interface{}{"route": rCfg.RouteName()})
+					continue
+				}
+				if coster != nil {
+					if err := coster.Fit(limits); err != nil {
+						logger.Error("Invalid rate limit cost, rate limiting disabled", err, map[string]interface{}{"route": rCfg.RouteName()})
+						continue
+					}
+				}
+				handlers = append(handlers, middleware.RateLimit(rCfg.RouteName(), limiter, limits, coster))
 			case "rbac":
 				handlers = append(handlers, middleware.RBAC(rCfg.AllowedRoles))
 			}
 		}
 
-		// Proxy handler
-		handlers = append(handlers, func(c fiber.Ctx) error {
-			u, ok := upstreams.GetUpstream(rCfg.Upstream)
-			if !ok {
-				return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "Upstream not found"})
-			}
+		routeConcurrency, err := concurrency.NewLimiter("route:"+rCfg.RouteName(), rCfg.Concurrency, cache.Client)
+		if err != nil {
+			logger.Error("Invalid concurrency limit, route disabled", err, map[string]interface{}{"route": rCfg.RouteName()})
+			continue
+		}
+		if routeConcurrency != nil {
+			handlers = append(handlers, middleware.Concurrency(routeConcurrency, cfg.Security.JWT))
+		}
 
-			targetURL, ok := u.GetNextURL()
-			if !ok {
-				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "No healthy upstream available"})
-			}
+		// Quotas count only requests auth and the limits above let through
+		if len(policies) > 0 {
+			handlers = append(handlers, middleware.Quota(quotas, cfg.Security.JWT))
+		}
 
-			// Track active connections
-			u.IncConnection(targetURL)
-			defer u.DecConnection(targetURL)
-
-			// Rewrite path if needed, or just append
-			// Simple append: targetURL + c.Path() (if targetURL is base)
-			// But targetURL might be full path.
-			// Let's assume targetURL is "http://host:port" and we append request URI.
-
-			// Handle path rewriting
-			// If route path ends with /*, strip the prefix
-			reqPath := c.Path()
-			routePath := rCfg.Path
-			if strings.HasSuffix(routePath, "/*") {
-				prefix := strings.TrimSuffix(routePath, "/*")
-				if strings.HasPrefix(reqPath, prefix) {
-					reqPath = strings.TrimPrefix(reqPath, prefix)
-				}
-			}
+		// Fault injection runs last so auth and rate limits behave normally
+		if fault := middleware.NewFaultInjector(rCfg.RouteName(), rCfg.Fault); fault != nil {
+			faults[rCfg.RouteName()] = fault
+			handlers = append(handlers, fault.Handler())
+		}
+
+		// Decode request bodies only once the request is let through
+		if rCfg.RequestDecompression.Enabled {
+			handlers = append(handlers, middleware.Decompression(rCfg.RequestDecompression))
+		}
 
-			// Ensure leading slash
-			if !strings.HasPrefix(reqPath, "/") {
-				reqPath = "/" + reqPath
+		if rCfg.Type == routeTypeCompose {
+			composer, err := NewComposer(rCfg.RouteName(), rCfg.Compose, proxyClient, upstreams, middleware.RequestIDHeader(cfg.Server.RequestID))
+			if err != nil {
+				logger.Error("Invalid composition, route disabled", err, map[string]interface{}{"route": rCfg.RouteName()})
+				continue
 			}
+			handlers = append(handlers, composer.Handle)
+			app.Add(rCfg.Methods, rCfg.Path, handlers[0], handlers[1:]...)
+			continue
+		}
 
-			reqURL := targetURL + reqPath
+		// Static, redirect and mock routes answer without an upstream
+		if isDirect(rCfg) {
+			direct, err := directHandler(rCfg)
+			if err != nil {
+				logger.Error("Invalid direct response, route disabled", err, map[string]interface{}{"route": rCfg.RouteName()})
+				continue
+			}
+			handlers = append(handlers, direct)
+			app.Add(rCfg.Methods, rCfg.Path, handlers[0], handlers[1:]...)
+			continue
+		}
 
-			return proxyClient.Do(c.Request(), c.Response(), reqURL)
-		})
+		// Proxy handler
+		rp := &routeProxy{
+			cfg:             rCfg,
+			prefix:          prefix,
+			client:          proxyClient,
+			upstreams:       upstreams,
+			matcher:         matcher,
+			splitter:        splitter,
+			mirror:          mirror,
+			rewriter:        rewriter,
+			requestHeaders:  requestHeaders,
+			responseHeaders: responseHeaders,
+			requestBody:     requestBody,
+			responseBody:    responseBody,
+			coalescer:       httpcache.NewCoalescer(rCfg.RouteName(), rCfg.Coalesce),
+			maintenance:     maintenance.upstreams,
+			concurrency:     upstreamConcurrency,
+			adaptive:        adaptiveConcurrency,
+			shedder:         shedder,
+		}
+		if rCfg.Cache.Enabled {
+			if responseStore == nil {
+				responseStore = httpcache.NewStore(cfg.ResponseCache, cache.Client)
+			}
+			rp.cache = httpcache.New(rCfg.RouteName(), rCfg.Cache, responseStore)
+		}
+		handlers = append(handlers, rp.handle)
 
 		// Register for each method
 		// Register for methods
 		app.Add(rCfg.Methods, rCfg.Path, handlers[0], handlers[1:]...)
 	}
+
+	registerAdmin(adminAPI, splitters, faults, maintenance, quotas, plans)
+	if responseStore != nil {
+		httpcache.RegisterAdmin(adminAPI, responseStore)
+	}
+}
+
+// routePrefix returns the path prefix that is stripped before proxying, or an
+// empty string if the route is not a wildcard route.
+func routePrefix(routePath string) string {
+	if strings.HasSuffix(routePath, "/*") {
+		return strings.TrimSuffix(routePath, "/*")
+	}
+	return ""
+}
+
+// routeLimits builds the limits of a route's "ratelimit" middleware. Fields
+// the rate_limits entries leave unset come from security.rate_limit, except
+// that weighted routes spend from a token bucket by default.
+func routeLimits(rCfg config.RouteConfig, defaults config.RateLimitConfig, weighted bool) ([]ratelimit.Limit, error) {
+	cfgs := rCfg.RateLimits
+	if len(cfgs) == 0 {
+		cfgs = []config.LimitConfig{{}}
+	}
+
+	limits := make([]ratelimit.Limit, 0, len(cfgs))
+	for i, lCfg := range cfgs {
+		if lCfg.Algorithm == "" {
+			lCfg.Algorithm = defaults.Algorithm
+			if weighted {
+				lCfg.Algorithm = ratelimit.TokenBucket
+			}
+		}
+		if lCfg.WindowSeconds == 0 {
+			lCfg.WindowSeconds = defaults.WindowSeconds
+		}
+		// The default burst is sized for per_route, not for other limits
+		if lCfg.Limit == 0 {
+			lCfg.Limit = defaults.PerRoute
+			if lCfg.Burst == 0 {
+				lCfg.Burst = defaults.Burst
+			}
+		}
+
+		name := lCfg.Name
+		if name == "" {
+			name = fmt.Sprintf("%s:%d", rCfg.RouteName(), i)
+		}
+		limit, err := ratelimit.NewLimit(name, lCfg)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit %q: %w", name, err)
+		}
+		limit.Tier = ratelimit.TierRoute
+		limits = append(limits, limit)
+	}
+	return limits, nil
 }
@@ -0,0 +1,92 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"vibeway/internal/admin"
+	"vibeway/internal/config"
+	"vibeway/internal/middleware"
+	"vibeway/internal/upstream"
+	"vibeway/pkg/cache"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestGateway wires cfg up the way main does, with a miniredis server
+// standing in for Redis.
+func newTestGateway(t *testing.T, cfg config.Config) *fiber.App {
+	t.Helper()
+	return newTestInstance(t, miniredis.RunT(t), cfg)
+}
+
+// newTestInstance is newTestGateway for one of several gateway instances
+// sharing mr.
+func newTestInstance(t *testing.T, mr *miniredis.Miniredis, cfg config.Config) *fiber.App {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	cache.Client = client
+
+	app := fiber.New(fiber.Config{ErrorHandler: middleware.ErrorHandler})
+	app.Use(middleware.RequestID(cfg.Server.RequestID))
+	SetupRoutes(app, cfg, upstream.NewManager(cfg.Upstreams), admin.New(app, cfg.Admin))
+	return app
+}
+
+// newTestUpstream starts a backend that answers with its name in the
+// X-Upstream header and the body, or with handler if one is given.
+func newTestUpstream(t *testing.T, name string, handler http.HandlerFunc) config.UpstreamConfig {
+	t.Helper()
+	if handler == nil {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Upstream", name)
+			w.Write([]byte(name))
+		}
+	}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return config.UpstreamConfig{URLs: []string{srv.URL}}
+}
+
+// testJWT is the JWT config tokens from testToken validate against.
+var testJWT = config.JWTConfig{Issuer: "vibeway-test", Audience: "vibeway", Secret: "test-secret"}
+
+// testToken signs claims, plus issuer and audience, for testJWT.
+func testToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	claims["iss"] = testJWT.Issuer
+	claims["aud"] = testJWT.Audience
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testJWT.Secret))
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return token
+}
+
+// testAdmin is the admin API config adminRequest authenticates against.
+var testAdmin = config.AdminConfig{Token: "admin-token"}
+
+// adminRequest builds an authenticated admin API call with a JSON body.
+func adminRequest(method, path string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("Authorization", "Bearer "+testAdmin.Token)
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+// do sends req through app and fails the test if the gateway does not answer.
+func do(t *testing.T, app *fiber.App, req *http.Request) *http.Response {
+	t.Helper()
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", req.Method, req.URL, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
@@ -0,0 +1,149 @@
+package router
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"vibeway/internal/config"
+	"vibeway/internal/metrics"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+const defaultStickyTTL = 24 * time.Hour
+
+type variant struct {
+	upstream string
+	weight   int
+}
+
+// Splitter picks one of several upstreams for a route by weight. Weights can
+// be changed at runtime through SetWeights.
+type Splitter struct {
+	route     string
+	cookie    string
+	cookieTTL time.Duration
+
+	mu       sync.RWMutex
+	variants []variant
+	total    int
+}
+
+// NewSplitter returns nil if the route has no split configured.
+func NewSplitter(route string, cfg config.SplitConfig) *Splitter {
+	if len(cfg.Variants) == 0 {
+		return nil
+	}
+
+	s := &Splitter{
+		route:     route,
+		cookie:    cfg.StickyCookie,
+		cookieTTL: time.Duration(cfg.StickyTTLSeconds) * time.Second,
+	}
+	if s.cookieTTL <= 0 {
+		s.cookieTTL = defaultStickyTTL
+	}
+
+	for _, v := range cfg.Variants {
+		s.variants = append(s.variants, variant{upstream: v.Upstream, weight: max(v.Weight, 0)})
+		s.total += max(v.Weight, 0)
+	}
+	return s
+}
+
+// Pick chooses the upstream for this request. A sticky cookie naming a
+// variant that still has weight wins; otherwise a variant is drawn by weight.
+// sticky reports whether the draw should be remembered with Stick.
+func (s *Splitter) Pick(c fiber.Ctx) (upstream string, sticky bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.cookie != "" {
+		if assigned := c.Cookies(s.cookie); assigned != "" {
+			for _, v := range s.variants {
+				if v.upstream == assigned && v.weight > 0 {
+					metrics.VariantRequestsTotal.WithLabelValues(s.route, v.upstream).Inc()
+					return v.upstream, false
+				}
+			}
+		}
+	}
+
+	picked := s.draw()
+	metrics.VariantRequestsTotal.WithLabelValues(s.route, picked).Inc()
+	return picked, s.cookie != ""
+}
+
+// Stick sets the sticky cookie for upstream. It must be called once the
+// response is final, as proxying replaces the response headers.
+func (s *Splitter) Stick(c fiber.Ctx, upstream string) {
+	c.Cookie(&fiber.Cookie{
+		Name:     s.cookie,
+		Value:    upstream,
+		Path:     "/",
+		Expires:  time.Now().Add(s.cookieTTL),
+		HTTPOnly: true,
+	})
+}
+
+func (s *Splitter) draw() string {
+	if s.total <= 0 {
+		// Everything weighted to zero: fall back to the first variant
+		return s.variants[0].upstream
+	}
+
+	n := rand.IntN(s.total)
+	for _, v := range s.variants {
+		if n < v.weight {
+			return v.upstream
+		}
+		n -= v.weight
+	}
+	return s.variants[len(s.variants)-1].upstream
+}
+
+// Weights returns the current weight of every variant.
+func (s *Splitter) Weights() map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	weights := make(map[string]int, len(s.variants))
+	for _, v := range s.variants {
+		weights[v.upstream] = v.weight
+	}
+	return weights
+}
+
+// SetWeights updates variant weights. Every named upstream must already be a
+// variant of the route; variants left out keep their weight.
+func (s *Splitter) SetWeights(weights map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, w := range weights {
+		if w < 0 {
+			return fmt.Errorf("weight for %q must not be negative", name)
+		}
+		found := false
+		for _, v := range s.variants {
+			if v.upstream == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("upstream %q is not a variant of route %q", name, s.route)
+		}
+	}
+
+	s.total = 0
+	for i := range s.variants {
+		if w, ok := weights[s.variants[i].upstream]; ok {
+			s.variants[i].weight = w
+		}
+		s.total += s.variants[i].weight
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"vibeway/internal/config"
+)
+
+func TestSplitStickyCookie(t *testing.T) {
+	app := newTestGateway(t, config.Config{
+		Upstreams: map[string]config.UpstreamConfig{
+			"stable": newTestUpstream(t, "stable", nil),
+			"canary": newTestUpstream(t, "canary", nil),
+		},
+		Routes: []config.RouteConfig{{
+			Path:     "/api/*",
+			Methods:  []string{"GET"},
+			Upstream: "stable",
+			Split: config.SplitConfig{
+				Variants: []config.VariantConfig{
+					{Upstream: "stable", Weight: 50},
+					{Upstream: "canary", Weight: 50},
+				},
+				StickyCookie: "variant",
+			},
+		}},
+	})
+
+	resp := do(t, app, httptest.NewRequest(http.MethodGet, "/api/items", nil))
+	assigned := resp.Header.Get("X-Upstream")
+	var cookie *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == "variant" {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatalf("no sticky cookie on the proxied response, Set-Cookie: %q", resp.Header.Values("Set-Cookie"))
+	}
+	if cookie.Value != assigned {
+		t.Fatalf("cookie names %q, but %q served the request", cookie.Value, assigned)
+	}
+
+	// Without stickiness 20 draws would all land on one side 1 in 2^19 times
+	for i := range 20 {
+		req := httptest.NewRequest(http.MethodGet, "/api/items", nil)
+		req.AddCookie(&http.Cookie{Name: "variant", Value: cookie.Value})
+		resp := do(t, app, req)
+		if got := resp.Header.Get("X-Upstream"); got != assigned {
+			t.Fatalf("request %d went to %q, want the assigned %q", i, got, assigned)
+		}
+		if len(resp.Cookies()) != 0 {
+			t.Errorf("request %d got the cookie again", i)
+		}
+	}
+}
+
+func TestSplitWeightsChangeAtRuntime(t *testing.T) {
+	app := newTestGateway(t, config.Config{
+		Admin: testAdmin,
+		Upstreams: map[string]config.UpstreamConfig{
+			"stable": newTestUpstream(t, "stable", nil),
+			"canary": newTestUpstream(t, "canary", nil),
+		},
+		Routes: []config.RouteConfig{{
+			Name:     "api",
+			Path:     "/api/*",
+			Methods:  []string{"GET"},
+			Upstream: "stable",
+			Split: config.SplitConfig{
+				Variants: []config.VariantConfig{
+					{Upstream: "stable", Weight: 1},
+					{Upstream: "canary", Weight: 0},
+				},
+				StickyCookie: "variant",
+			},
+		}},
+	})
+	served := func(cookie string) (upstream, setCookie string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/items", nil)
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "variant", Value: cookie})
+		}
+		resp := do(t, app, req)
+		for _, c := range resp.Cookies() {
+			if c.Name == "variant" {
+				setCookie = c.Value
+			}
+		}
+		return resp.Header.Get("X-Upstream"), setCookie
+	}
+	setWeights := func(body string) int {
+		t.Helper()
+		return do(t, app, adminRequest(http.MethodPut, "/admin/routes/api/split", strings.NewReader(body))).StatusCode
+	}
+
+	for range 10 {
+		if got, _ := served(""); got != "stable" {
+			t.Fatalf("served by %q while canary has no weight", got)
+		}
+	}
+
+	if status := setWeights(`{"weights": {"preview": 1}}`); status != http.StatusBadRequest {
+		t.Errorf("weight for an unknown variant: status %d, want 400", status)
+	}
+	if status := setWeights(`{"weights": {"stable": 0, "canary": 1}}`); status != http.StatusOK {
+		t.Fatalf("shifting traffic to canary: status %d", status)
+	}
+
+	// A cookie for a variant without weight is drawn again and replaced
+	if got, cookie := served("stable"); got != "canary" || cookie != "canary" {
+		t.Errorf("stale cookie: served by %q, new cookie %q; want canary for both", got, cookie)
+	}
+
+	var out struct {
+		Weights map[string]int `json:"weights"`
+	}
+	resp := do(t, app, adminRequest(http.MethodGet, "/admin/routes/api/split", nil))
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Weights["stable"] != 0 || out.Weights["canary"] != 1 {
+		t.Errorf("weights = %v, want stable 0 and canary 1", out.Weights)
+	}
+}
@@ -0,0 +1,71 @@
+package tracing
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "vibeway"
+
+// Tracer returns the gateway tracer from the global provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Middleware starts a server span for every request, continuing any trace
+// context sent by the client, and propagates it to the upstream request.
+func Middleware() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		carrier := HeaderCarrier{Header: &c.Request().Header}
+		ctx := otel.GetTextMapPropagator().Extract(c.Context(), carrier)
+
+		ctx, span := Tracer().Start(ctx, c.Method()+" "+c.Path(), trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
+		c.SetContext(ctx)
+		otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		span.SetName(c.Method() + " " + c.Route().Path)
+		span.SetAttributes(
+			attribute.String("http.method", c.Method()),
+			attribute.String("http.target", c.Path()),
+			attribute.Int("http.status_code", status),
+		)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, fasthttp.StatusMessage(status))
+		}
+
+		return err
+	}
+}
+
+// HeaderCarrier adapts a fasthttp request header to a propagation.TextMapCarrier.
+type HeaderCarrier struct {
+	Header *fasthttp.RequestHeader
+}
+
+func (hc HeaderCarrier) Get(key string) string {
+	return string(hc.Header.Peek(key))
+}
+
+func (hc HeaderCarrier) Set(key, value string) {
+	hc.Header.Set(key, value)
+}
+
+func (hc HeaderCarrier) Keys() []string {
+	var keys []string
+	for k := range hc.Header.All() {
+		keys = append(keys, string(k))
+	}
+	return keys
+}
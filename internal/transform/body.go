@@ -0,0 +1,157 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"vibeway/internal/config"
+)
+
+const defaultBodyMaxBytes = 1 << 20 // 1 MiB
+
+type bodyOp struct {
+	op    string
+	path  []step
+	to    []step // move target
+	name  string // rename target
+	value interface{}
+}
+
+// BodyRules is a compiled list of JSON body operations.
+type BodyRules struct {
+	ops      []bodyOp
+	maxBytes int
+}
+
+func NewBodyRules(cfg config.BodyTransformConfig) (*BodyRules, error) {
+	b := &BodyRules{maxBytes: cfg.MaxBytes}
+	if b.maxBytes <= 0 {
+		b.maxBytes = defaultBodyMaxBytes
+	}
+
+	for _, opCfg := range cfg.Operations {
+		path, err := parsePath(opCfg.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		op := bodyOp{op: opCfg.Op, path: path}
+		switch opCfg.Op {
+		case "remove":
+		case "set":
+			op.value = opCfg.Value
+		case "rename":
+			if opCfg.To == "" || strings.ContainsAny(opCfg.To, ".[]$") {
+				return nil, fmt.Errorf("rename of %q needs a plain key name in 'to'", opCfg.Path)
+			}
+			if path[len(path)-1].isIndex || path[len(path)-1].wildcard {
+				return nil, fmt.Errorf("rename of %q must select an object key", opCfg.Path)
+			}
+			op.name = opCfg.To
+		case "move":
+			// A move carries one value; several sources would collide
+			for _, s := range path {
+				if s.wildcard {
+					return nil, fmt.Errorf("move of %q must select a single value, not a wildcard", opCfg.Path)
+				}
+			}
+			if op.to, err = parsePath(opCfg.To); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unknown body operation %q", opCfg.Op)
+		}
+		b.ops = append(b.ops, op)
+	}
+
+	return b, nil
+}
+
+// Empty reports whether there is nothing to apply.
+func (b *BodyRules) Empty() bool {
+	return len(b.ops) == 0
+}
+
+// Transform applies the operations to body if it is an uncompressed JSON
+// document no larger than the size cap. It reports whether any operation
+// matched; otherwise the body passes through byte for byte.
+func (b *BodyRules) Transform(body []byte, contentType, contentEncoding string) ([]byte, bool) {
+	if len(body) == 0 || len(body) > b.maxBytes || contentEncoding != "" || !isJSON(contentType) {
+		return body, false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber() // Keep large integers intact
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return body, false
+	}
+
+	changed := false
+	track := func(create bool, leaf func(node interface{}, s step) interface{}) func(node interface{}, s step) interface{} {
+		return func(node interface{}, s step) interface{} {
+			if hasLeaf(node, s, create) {
+				changed = true
+			}
+			return leaf(node, s)
+		}
+	}
+
+	for _, op := range b.ops {
+		switch op.op {
+		case "remove":
+			doc = update(doc, op.path, false, track(false, removeLeaf))
+		case "set":
+			doc = update(doc, op.path, true, track(true, setLeaf(op.value)))
+		case "rename":
+			doc = update(doc, op.path, false, track(false, renameLeaf(op.name)))
+		case "move":
+			if v, ok := lookup(doc, op.path); ok {
+				doc = update(doc, op.path, false, removeLeaf)
+				doc = update(doc, op.to, true, setLeaf(v))
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return body, false
+	}
+
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return body, false
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n")), true
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// hasLeaf reports whether an operation on step s of node has anything to
+// act on. With create, a missing object key counts, as set adds it.
+func hasLeaf(node interface{}, s step, create bool) bool {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if s.wildcard {
+			return len(n) > 0
+		}
+		if s.isIndex {
+			return false
+		}
+		_, ok := n[s.key]
+		return ok || create
+	case []interface{}:
+		if s.wildcard {
+			return len(n) > 0
+		}
+		return s.isIndex && s.index < len(n)
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package transform
+
+import (
+	"testing"
+
+	"vibeway/internal/config"
+)
+
+func TestBodyRulesTransform(t *testing.T) {
+	tests := []struct {
+		name        string
+		ops         []config.BodyOperationConfig
+		body        string
+		contentType string
+		encoding    string
+		want        string
+		changed     bool
+	}{
+		{
+			name:    "remove key",
+			ops:     []config.BodyOperationConfig{{Op: "remove", Path: "$.secret"}},
+			body:    `{"id":1,"secret":"x"}`,
+			want:    `{"id":1}`,
+			changed: true,
+		},
+		{
+			name:    "remove under wildcard",
+			ops:     []config.BodyOperationConfig{{Op: "remove", Path: "$.items[*].internal_notes"}},
+			body:    `{"items":[{"id":1,"internal_notes":"a"},{"id":2}]}`,
+			want:    `{"items":[{"id":1},{"id":2}]}`,
+			changed: true,
+		},
+		{
+			name:    "remove array index",
+			ops:     []config.BodyOperationConfig{{Op: "remove", Path: "$.tags[0]"}},
+			body:    `{"tags":["a","b"]}`,
+			want:    `{"tags":["b"]}`,
+			changed: true,
+		},
+		{
+			name:    "set creates missing objects",
+			ops:     []config.BodyOperationConfig{{Op: "set", Path: "$.meta.source", Value: "gateway"}},
+			body:    `{"id":1}`,
+			want:    `{"id":1,"meta":{"source":"gateway"}}`,
+			changed: true,
+		},
+		{
+			name:    "rename key",
+			ops:     []config.BodyOperationConfig{{Op: "rename", Path: "$.user_name", To: "username"}},
+			body:    `{"user_name":"ada"}`,
+			want:    `{"username":"ada"}`,
+			changed: true,
+		},
+		{
+			name:    "move value",
+			ops:     []config.BodyOperationConfig{{Op: "move", Path: "$.legacy.id", To: "$.id"}},
+			body:    `{"legacy":{"id":7}}`,
+			want:    `{"id":7,"legacy":{}}`,
+			changed: true,
+		},
+		{
+			name:    "large numbers keep their precision",
+			ops:     []config.BodyOperationConfig{{Op: "remove", Path: "$.x"}},
+			body:    `{"id":9007199254740993,"x":1}`,
+			want:    `{"id":9007199254740993}`,
+			changed: true,
+		},
+		{
+			name: "no match keeps the bytes",
+			ops: []config.BodyOperationConfig{
+				{Op: "remove", Path: "$.missing"},
+				{Op: "rename", Path: "$.absent", To: "present"},
+				{Op: "move", Path: "$.nowhere", To: "$.somewhere"},
+			},
+			body: `{"z": 1,  "a": 2}`,
+			want: `{"z": 1,  "a": 2}`,
+		},
+		{
+			name:     "encoded body is skipped",
+			ops:      []config.BodyOperationConfig{{Op: "remove", Path: "$.secret"}},
+			body:     `{"secret":"x"}`,
+			encoding: "gzip",
+			want:     `{"secret":"x"}`,
+		},
+		{
+			name:        "non-JSON content type is skipped",
+			ops:         []config.BodyOperationConfig{{Op: "remove", Path: "$.secret"}},
+			body:        `{"secret":"x"}`,
+			contentType: "text/plain",
+			want:        `{"secret":"x"}`,
+		},
+		{
+			name: "invalid JSON is skipped",
+			ops:  []config.BodyOperationConfig{{Op: "remove", Path: "$.secret"}},
+			body: `{"secret":`,
+			want: `{"secret":`,
+		},
+		{
+			name:        "JSON suffix content type",
+			ops:         []config.BodyOperationConfig{{Op: "remove", Path: "$.secret"}},
+			body:        `{"secret":"x"}`,
+			contentType: "application/problem+json; charset=utf-8",
+			want:        `{}`,
+			changed:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := NewBodyRules(config.BodyTransformConfig{Operations: tt.ops})
+			if err != nil {
+				t.Fatalf("NewBodyRules: %v", err)
+			}
+			contentType := tt.contentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+
+			got, changed := rules.Transform([]byte(tt.body), contentType, tt.encoding)
+			if string(got) != tt.want || changed != tt.changed {
+				t.Errorf("Transform = %s, %v; want %s, %v", got, changed, tt.want, tt.changed)
+			}
+		})
+	}
+}
+
+func TestBodyRulesTransformMaxBytes(t *testing.T) {
+	rules, err := NewBodyRules(config.BodyTransformConfig{
+		MaxBytes:   8,
+		Operations: []config.BodyOperationConfig{{Op: "remove", Path: "$.secret"}},
+	})
+	if err != nil {
+		t.Fatalf("NewBodyRules: %v", err)
+	}
+	body := `{"secret":"x"}`
+	if got, changed := rules.Transform([]byte(body), "application/json", ""); string(got) != body || changed {
+		t.Errorf("Transform = %s, %v; want the body unchanged", got, changed)
+	}
+}
+
+func TestNewBodyRulesInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		op   config.BodyOperationConfig
+	}{
+		{"unknown op", config.BodyOperationConfig{Op: "copy", Path: "$.a"}},
+		{"root path", config.BodyOperationConfig{Op: "remove", Path: "$"}},
+		{"rename to path", config.BodyOperationConfig{Op: "rename", Path: "$.a", To: "b.c"}},
+		{"rename index", config.BodyOperationConfig{Op: "rename", Path: "$.a[0]", To: "b"}},
+		{"move without target", config.BodyOperationConfig{Op: "move", Path: "$.a"}},
+		{"move from wildcard", config.BodyOperationConfig{Op: "move", Path: "$.items[*].id", To: "$.id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewBodyRules(config.BodyTransformConfig{Operations: []config.BodyOperationConfig{tt.op}}); err == nil {
+				t.Error("NewBodyRules succeeded, want an error")
+			}
+		})
+	}
+}
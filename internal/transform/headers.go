@@ -0,0 +1,120 @@
+package transform
+
+import (
+	"iter"
+	"sort"
+	"strings"
+
+	"vibeway/internal/config"
+)
+
+// headers is the subset of fasthttp.RequestHeader and fasthttp.ResponseHeader
+// needed to apply header rules to either direction.
+type headers interface {
+	All() iter.Seq2[[]byte, []byte]
+	PeekAll(key string) [][]byte
+	Set(key, value string)
+	Add(key, value string)
+	Del(key string)
+}
+
+type headerValue struct {
+	name     string
+	template *Template
+}
+
+// HeaderRules is a compiled set of header operations. They are applied in a
+// fixed order: remove, rename, set, add.
+type HeaderRules struct {
+	remove       []string
+	removePrefix []string
+	rename       [][2]string
+	set          []headerValue
+	add          []headerValue
+}
+
+func NewHeaderRules(cfg config.HeaderTransformConfig) *HeaderRules {
+	h := &HeaderRules{}
+
+	for _, name := range cfg.Remove {
+		if prefix, ok := strings.CutSuffix(name, "*"); ok {
+			h.removePrefix = append(h.removePrefix, strings.ToLower(prefix))
+		} else {
+			h.remove = append(h.remove, name)
+		}
+	}
+
+	// Maps have no order; sort so the result is deterministic
+	for _, from := range sortedKeys(cfg.Rename) {
+		h.rename = append(h.rename, [2]string{from, cfg.Rename[from]})
+	}
+	for _, name := range sortedKeys(cfg.Set) {
+		h.set = append(h.set, headerValue{name: name, template: CompileTemplate(cfg.Set[name])})
+	}
+	for _, name := range sortedKeys(cfg.Add) {
+		h.add = append(h.add, headerValue{name: name, template: CompileTemplate(cfg.Add[name])})
+	}
+
+	return h
+}
+
+// Empty reports whether there is nothing to apply.
+func (h *HeaderRules) Empty() bool {
+	return len(h.remove) == 0 && len(h.removePrefix) == 0 && len(h.rename) == 0 &&
+		len(h.set) == 0 && len(h.add) == 0
+}
+
+func (h *HeaderRules) Apply(hdr headers, v *Vars) {
+	for _, name := range h.remove {
+		hdr.Del(name)
+	}
+
+	if len(h.removePrefix) > 0 {
+		var matched []string
+		for key := range hdr.All() {
+			lower := strings.ToLower(string(key))
+			for _, prefix := range h.removePrefix {
+				if strings.HasPrefix(lower, prefix) {
+					matched = append(matched, string(key))
+					break
+				}
+			}
+		}
+		for _, name := range matched {
+			hdr.Del(name)
+		}
+	}
+
+	for _, r := range h.rename {
+		values := hdr.PeekAll(r[0])
+		if len(values) == 0 {
+			continue
+		}
+		copied := make([]string, len(values))
+		for i, val := range values {
+			copied[i] = string(val)
+		}
+		hdr.Del(r[0])
+		hdr.Del(r[1])
+		for _, val := range copied {
+			hdr.Add(r[1], val)
+		}
+	}
+
+	for _, hv := range h.set {
+		hdr.Set(hv.name, hv.template.Render(v))
+	}
+
+	for _, hv := range h.add {
+		hdr.Add(hv.name, hv.template.Render(v))
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,227 @@
+package transform
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// step is one segment of a compiled JSONPath-style selector.
+type step struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parsePath compiles the supported JSONPath subset: $, .key, ['key'], [n],
+// [*] and .* (e.g. "$.items[*].internal_notes"). The leading "$" is optional.
+func parsePath(path string) ([]step, error) {
+	p := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	var steps []step
+
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			end := strings.IndexAny(p, ".[")
+			if end == -1 {
+				end = len(p)
+			}
+			name := p[:end]
+			if name == "" {
+				return nil, fmt.Errorf("empty key in path %q", path)
+			}
+			if name == "*" {
+				steps = append(steps, step{wildcard: true})
+			} else {
+				steps = append(steps, step{key: name})
+			}
+			p = p[end:]
+		case '[':
+			end := strings.IndexByte(p, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated bracket in path %q", path)
+			}
+			inner := p[1:end]
+			p = p[end+1:]
+			switch {
+			case inner == "*":
+				steps = append(steps, step{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				steps = append(steps, step{key: inner[1 : len(inner)-1]})
+			default:
+				idx, err := strconv.Atoi(inner)
+				if err != nil || idx < 0 {
+					return nil, fmt.Errorf("invalid index %q in path %q", inner, path)
+				}
+				steps = append(steps, step{index: idx, isIndex: true})
+			}
+		default:
+			// Allow a bare first key, e.g. "user.name"
+			if len(steps) > 0 {
+				return nil, fmt.Errorf("unexpected %q in path %q", p[0], path)
+			}
+			p = "." + p
+		}
+	}
+
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("path %q selects the document root", path)
+	}
+	return steps, nil
+}
+
+// dottedPath compiles a plain "a.b.0.c" path as used in templates, where
+// numeric segments are array indexes.
+func dottedPath(path string) []step {
+	if path == "" {
+		return nil
+	}
+	parts := strings.Split(path, ".")
+	steps := make([]step, 0, len(parts))
+	for _, part := range parts {
+		if i, err := strconv.Atoi(part); err == nil && i >= 0 {
+			steps = append(steps, step{index: i, isIndex: true})
+			continue
+		}
+		steps = append(steps, step{key: part})
+	}
+	return steps
+}
+
+// update walks node along steps and hands every container matched by the
+// second-to-last step to leaf, together with the final step. It returns the
+// possibly replaced node, as slices may be reallocated. When create is set,
+// missing object keys on the way are created.
+func update(node interface{}, steps []step, create bool, leaf func(node interface{}, s step) interface{}) interface{} {
+	if len(steps) == 1 {
+		return leaf(node, steps[0])
+	}
+
+	s, rest := steps[0], steps[1:]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if s.wildcard {
+			for k, v := range n {
+				n[k] = update(v, rest, create, leaf)
+			}
+			return n
+		}
+		if s.isIndex {
+			return n
+		}
+		child, ok := n[s.key]
+		if !ok {
+			if !create || rest[0].isIndex || rest[0].wildcard {
+				return n
+			}
+			child = map[string]interface{}{}
+		}
+		n[s.key] = update(child, rest, create, leaf)
+		return n
+	case []interface{}:
+		if s.wildcard {
+			for i, v := range n {
+				n[i] = update(v, rest, create, leaf)
+			}
+			return n
+		}
+		if s.isIndex && s.index < len(n) {
+			n[s.index] = update(n[s.index], rest, create, leaf)
+		}
+		return n
+	}
+	return node
+}
+
+// lookup returns the first value matched by steps.
+func lookup(node interface{}, steps []step) (interface{}, bool) {
+	if len(steps) == 0 {
+		return node, true
+	}
+
+	s, rest := steps[0], steps[1:]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if s.wildcard {
+			for _, v := range n {
+				if found, ok := lookup(v, rest); ok {
+					return found, true
+				}
+			}
+			return nil, false
+		}
+		if child, ok := n[s.key]; ok && !s.isIndex {
+			return lookup(child, rest)
+		}
+	case []interface{}:
+		if s.wildcard {
+			for _, v := range n {
+				if found, ok := lookup(v, rest); ok {
+					return found, true
+				}
+			}
+			return nil, false
+		}
+		if s.isIndex && s.index < len(n) {
+			return lookup(n[s.index], rest)
+		}
+	}
+	return nil, false
+}
+
+func removeLeaf(node interface{}, s step) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if s.wildcard {
+			clear(n)
+		} else if !s.isIndex {
+			delete(n, s.key)
+		}
+	case []interface{}:
+		if s.wildcard {
+			return n[:0]
+		}
+		if s.isIndex && s.index < len(n) {
+			return append(n[:s.index], n[s.index+1:]...)
+		}
+	}
+	return node
+}
+
+func setLeaf(value interface{}) func(node interface{}, s step) interface{} {
+	return func(node interface{}, s step) interface{} {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			if s.wildcard {
+				for k := range n {
+					n[k] = value
+				}
+			} else if !s.isIndex {
+				n[s.key] = value
+			}
+		case []interface{}:
+			if s.wildcard {
+				for i := range n {
+					n[i] = value
+				}
+			} else if s.isIndex && s.index < len(n) {
+				n[s.index] = value
+			}
+		}
+		return node
+	}
+}
+
+func renameLeaf(to string) func(node interface{}, s step) interface{} {
+	return func(node interface{}, s step) interface{} {
+		if n, ok := node.(map[string]interface{}); ok && !s.wildcard && !s.isIndex {
+			if v, exists := n[s.key]; exists {
+				delete(n, s.key)
+				n[to] = v
+			}
+		}
+		return node
+	}
+}
@@ -0,0 +1,228 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Vars holds the per-request values that header templates may reference.
+type Vars struct {
+	Claims      jwt.MapClaims
+	ClientIP    string
+	RequestID   string
+	Route       string
+	UpstreamURL string
+	Params      map[string]string // Route path captures, e.g. ${path.id}
+	Query       string            // Raw query string, ${query}
+
+	// Responses holds decoded sub-call responses of a composition route,
+	// referenced as ${calls.<name>} or ${calls.<name>.items.0.id}.
+	Responses map[string]interface{}
+}
+
+// placeholderPattern matches ${name} placeholders, e.g. ${claims.tenant},
+// ${client_ip}, ${request_id}, ${route}, ${upstream_url}, ${path.id},
+// ${path.*}, ${query}, ${calls.user.id} or ${env.REGION}.
+var placeholderPattern = regexp.MustCompile(`\$\{([a-zA-Z0-9_.*\-]+)\}`)
+
+type segment struct {
+	literal string
+	varName string
+}
+
+// Template is a header value with placeholders, compiled once at startup.
+type Template struct {
+	segments []segment
+	static   bool
+}
+
+func CompileTemplate(s string) *Template {
+	t := &Template{static: true}
+	last := 0
+	for _, m := range placeholderPattern.FindAllStringSubmatchIndex(s, -1) {
+		if m[0] > last {
+			t.segments = append(t.segments, segment{literal: s[last:m[0]]})
+		}
+		name := s[m[2]:m[3]]
+		// Environment variables are resolved once at compile time
+		if env, ok := strings.CutPrefix(name, "env."); ok {
+			t.segments = append(t.segments, segment{literal: os.Getenv(env)})
+		} else {
+			t.segments = append(t.segments, segment{varName: name})
+			t.static = false
+		}
+		last = m[1]
+	}
+	if last < len(s) {
+		t.segments = append(t.segments, segment{literal: s[last:]})
+	}
+	return t
+}
+
+// Render expands the template. Unknown or missing values render as empty.
+func (t *Template) Render(v *Vars) string {
+	if t.static && len(t.segments) == 1 {
+		return t.segments[0].literal
+	}
+
+	var b strings.Builder
+	for _, seg := range t.segments {
+		if seg.varName == "" {
+			b.WriteString(seg.literal)
+			continue
+		}
+		b.WriteString(v.lookup(seg.varName))
+	}
+	return b.String()
+}
+
+// RenderURL expands a URL template, escaping each value for where it lands:
+// url.PathEscape before the first "?" and url.QueryEscape after it. A
+// ${path.*} wildcard keeps its slashes and has each segment escaped;
+// ${query} and ${upstream_url} are already encoded and are inserted as is.
+func (t *Template) RenderURL(v *Vars) string {
+	var b strings.Builder
+	inQuery := false
+	for _, seg := range t.segments {
+		if seg.varName == "" {
+			b.WriteString(seg.literal)
+			inQuery = inQuery || strings.Contains(seg.literal, "?")
+			continue
+		}
+
+		val := v.lookup(seg.varName)
+		switch {
+		case seg.varName == "query" || seg.varName == "upstream_url":
+		case inQuery:
+			val = url.QueryEscape(val)
+		case strings.HasPrefix(seg.varName, "path.*"):
+			parts := strings.Split(val, "/")
+			for i, part := range parts {
+				parts[i] = url.PathEscape(part)
+			}
+			val = strings.Join(parts, "/")
+		default:
+			val = url.PathEscape(val)
+		}
+		b.WriteString(val)
+	}
+	return b.String()
+}
+
+// RenderJSON expands the template into a JSON document: sub-call values keep
+// their JSON type, other values become JSON strings and missing sub-call
+// values render as null.
+func (t *Template) RenderJSON(v *Vars) string {
+	var b strings.Builder
+	for _, seg := range t.segments {
+		if seg.varName == "" {
+			b.WriteString(seg.literal)
+			continue
+		}
+
+		var val interface{} = v.lookup(seg.varName)
+		if call, ok := strings.CutPrefix(seg.varName, "calls."); ok {
+			val, _ = v.callValue(call)
+		}
+		encoded, err := json.Marshal(val)
+		if err != nil {
+			encoded = []byte("null")
+		}
+		b.Write(encoded)
+	}
+	return b.String()
+}
+
+// Names returns the placeholder names used by the template.
+func (t *Template) Names() []string {
+	var names []string
+	for _, seg := range t.segments {
+		if seg.varName != "" {
+			names = append(names, seg.varName)
+		}
+	}
+	return names
+}
+
+func (v *Vars) lookup(name string) string {
+	if v == nil {
+		return ""
+	}
+
+	switch name {
+	case "client_ip":
+		return v.ClientIP
+	case "request_id":
+		return v.RequestID
+	case "route":
+		return v.Route
+	case "upstream_url":
+		return v.UpstreamURL
+	case "query":
+		return v.Query
+	}
+
+	if param, ok := strings.CutPrefix(name, "path."); ok {
+		return v.Params[param]
+	}
+
+	if claim, ok := strings.CutPrefix(name, "claims."); ok && v.Claims != nil {
+		return ClaimString(v.Claims[claim])
+	}
+
+	if call, ok := strings.CutPrefix(name, "calls."); ok {
+		val, _ := v.callValue(call)
+		switch val.(type) {
+		case map[string]interface{}, []interface{}:
+			encoded, _ := json.Marshal(val)
+			return string(encoded)
+		}
+		return ClaimString(val)
+	}
+	return ""
+}
+
+// callValue resolves "<call>.<field>..." against the sub-call responses.
+// Numeric segments index arrays.
+func (v *Vars) callValue(name string) (interface{}, bool) {
+	if v == nil {
+		return nil, false
+	}
+	call, path, _ := strings.Cut(name, ".")
+	resp, ok := v.Responses[call]
+	if !ok {
+		return nil, false
+	}
+	return lookup(resp, dottedPath(path))
+}
+
+// ClaimString renders a JWT claim value as a string. Arrays are joined with
+// commas and whole numbers are printed without a decimal point.
+func ClaimString(val interface{}) string {
+	switch c := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return c
+	case []interface{}:
+		parts := make([]string, 0, len(c))
+		for _, item := range c {
+			parts = append(parts, ClaimString(item))
+		}
+		return strings.Join(parts, ",")
+	case float64:
+		// JSON numbers decode as float64; render integers without a decimal point
+		if c == float64(int64(c)) {
+			return fmt.Sprintf("%d", int64(c))
+		}
+		return fmt.Sprintf("%g", c)
+	default:
+		return fmt.Sprint(c)
+	}
+}
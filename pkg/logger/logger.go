@@ -49,3 +49,46 @@ func Warn(msg string, fields map[string]interface{}) {
 	}
 	event.Msg(msg)
 }
+
+// Logger adds a fixed set of fields, such as a request ID, to every entry.
+type Logger struct {
+	fields map[string]interface{}
+}
+
+// With returns a Logger that adds fields to every entry it writes.
+func With(fields map[string]interface{}) *Logger {
+	return &Logger{fields: fields}
+}
+
+func (l *Logger) Info(msg string, fields map[string]interface{}) {
+	Info(msg, l.merge(fields))
+}
+
+func (l *Logger) Error(msg string, err error, fields map[string]interface{}) {
+	Error(msg, err, l.merge(fields))
+}
+
+func (l *Logger) Debug(msg string, fields map[string]interface{}) {
+	Debug(msg, l.merge(fields))
+}
+
+func (l *Logger) Warn(msg string, fields map[string]interface{}) {
+	Warn(msg, l.merge(fields))
+}
+
+func (l *Logger) merge(fields map[string]interface{}) map[string]interface{} {
+	if len(l.fields) == 0 {
+		return fields
+	}
+	if len(fields) == 0 {
+		return l.fields
+	}
+	merged := make(map[string]interface{}, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return merged
+}